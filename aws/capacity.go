@@ -0,0 +1,56 @@
+package aws
+
+import (
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ecs"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+const (
+	CapacityProviderFargate     = "FARGATE"
+	CapacityProviderFargateSpot = "FARGATE_SPOT"
+)
+
+// CapacityStrategy splits a service's tasks between on-demand Fargate and
+// Fargate Spot, i.e. Base 1 and SpotPercent 80 always runs one on-demand task
+// and places 80% of the remaining tasks on Spot.
+type CapacityStrategy struct {
+	// Base is the number of tasks always run on on-demand Fargate.
+	Base int
+
+	// SpotPercent is the share of tasks beyond Base run on Fargate Spot.
+	SpotPercent int
+}
+
+func (c *CapacityStrategy) Validate() error {
+	if c.Base < 0 || c.Base > 100000 {
+		return fmt.Errorf("CapacityStrategy.Base must be between 0 and 100000")
+	}
+
+	if c.SpotPercent < 0 || c.SpotPercent > 100 {
+		return fmt.Errorf("CapacityStrategy.SpotPercent must be between 0 and 100")
+	}
+
+	return nil
+}
+
+// Strategies returns the capacity provider strategies for the service.
+func (c *CapacityStrategy) Strategies() ecs.ServiceCapacityProviderStrategyArray {
+	strategies := ecs.ServiceCapacityProviderStrategyArray{
+		&ecs.ServiceCapacityProviderStrategyArgs{
+			CapacityProvider: pulumi.String(CapacityProviderFargate),
+			Base:             pulumi.Int(c.Base),
+			Weight:           pulumi.Int(100 - c.SpotPercent),
+		},
+	}
+
+	if c.SpotPercent > 0 {
+		strategies = append(strategies, &ecs.ServiceCapacityProviderStrategyArgs{
+			CapacityProvider: pulumi.String(CapacityProviderFargateSpot),
+			Weight:           pulumi.Int(c.SpotPercent),
+		})
+	}
+
+	return strategies
+}
@@ -6,15 +6,17 @@ import (
 )
 
 type ContainerDefinition struct {
-	Command          []string                  `json:"command,omitempty"`
-	Name             string                    `json:"name"`
-	Image            string                    `json:"image"`
-	PortMappings     []ContainerPortMapping    `json:"portMappings"`
-	Environment      []ContainerEnvVar         `json:"environment"`
-	LogConfiguration *ContainerLogConfig       `json:"logConfiguration"`
-	DockerLabels     map[string]string         `json:"dockerLabels"`
-	LinuxParameters  *ContainerLinuxParameters `json:"linuxParameters,omitempty"`
-	MountPoints      []ContainerMountPoint     `json:"mountPoints,omitempty"`
+	Command               []string                        `json:"command,omitempty"`
+	Name                  string                          `json:"name"`
+	Image                 string                          `json:"image"`
+	PortMappings          []ContainerPortMapping          `json:"portMappings"`
+	Environment           []ContainerEnvVar               `json:"environment"`
+	Secrets               []ContainerSecret               `json:"secrets,omitempty"`
+	LogConfiguration      *ContainerLogConfig             `json:"logConfiguration"`
+	DockerLabels          map[string]string               `json:"dockerLabels"`
+	LinuxParameters       *ContainerLinuxParameters       `json:"linuxParameters,omitempty"`
+	MountPoints           []ContainerMountPoint           `json:"mountPoints,omitempty"`
+	RepositoryCredentials *ContainerRepositoryCredentials `json:"repositoryCredentials,omitempty"`
 }
 
 func (d *ContainerDefinition) Validate() error {
@@ -60,10 +62,25 @@ type ContainerEnvVar struct {
 	Name  string `json:"name"`
 	Value string `json:"value"`
 }
+
+type ContainerSecret struct {
+	Name      string `json:"name"`
+	ValueFrom string `json:"valueFrom"`
+}
+
+// ContainerRepositoryCredentials references the Secrets Manager secret ECS
+// pulls the image from a private non-ECR registry with.
+type ContainerRepositoryCredentials struct {
+	CredentialsParameter string `json:"credentialsParameter"`
+}
+
 type ContainerPortMapping struct {
 	ContainerPort int    `json:"containerPort"`
 	HostPort      int    `json:"hostPort"`
 	Protocol      string `json:"protocol"`
+	// Name is referenced by Service Connect, AppProtocol is one of http, http2 or grpc.
+	Name        string `json:"name,omitempty"`
+	AppProtocol string `json:"appProtocol,omitempty"`
 }
 
 type ContainerLogConfig struct {
@@ -13,11 +13,42 @@ type Postgres struct {
 	VPC     *VPC
 	Replica bool
 
+	// Exports namespaces or disables the database's stack exports.
+	Exports *Exports
+
 	Out struct {
 		DB *rds.Instance
 	}
 }
 
+// PostgresOutputs are the database values other stacks consume.
+type PostgresOutputs struct {
+	Arn pulumi.StringOutput
+
+	// Endpoint is the <address>:<port> clients connect to.
+	Endpoint pulumi.StringOutput
+	Address  pulumi.StringOutput
+}
+
+// Outputs returns the database's outputs once it has been run.
+func (d *Postgres) Outputs() *PostgresOutputs {
+	return &PostgresOutputs{
+		Arn:      d.Out.DB.Arn,
+		Endpoint: d.Out.DB.Endpoint,
+		Address:  d.Out.DB.Address,
+	}
+}
+
+// PostgresOutputsFromStack reads the outputs of the named database from the
+// stack that deployed it, which must have been deployed with the same Exports.
+func PostgresOutputsFromStack(ref *pulumi.StackReference, name string, exports *Exports) *PostgresOutputs {
+	return &PostgresOutputs{
+		Arn:      exports.stringOutput(ref, name, "DB-ARN"),
+		Endpoint: exports.stringOutput(ref, name, "DB-ENDPOINT"),
+		Address:  exports.stringOutput(ref, name, "DB-ADDRESS"),
+	}
+}
+
 func (d *Postgres) Validate() error {
 	if d.Name == "" {
 		return fmt.Errorf("missing Postgres.Name")
@@ -46,17 +77,11 @@ func (d *Postgres) Run(ctx *pulumi.Context, opts ...pulumi.ResourceOption) error
 	if d.Args.ReplicateSourceDb == nil {
 		dbSubnetName := fmt.Sprintf("%v-db-subnet", d.Name)
 		dbSubnet, err := rds.NewSubnetGroup(ctx, dbSubnetName, &rds.SubnetGroupArgs{
-			SubnetIds: pulumi.StringArray{
-				d.VPC.Out.PublicSubnets[0].ID().ToStringOutput(), d.VPC.Out.PublicSubnets[1].ID().ToStringOutput(),
-				d.VPC.Out.PrivateSubnets[0].ID().ToStringOutput(), d.VPC.Out.PrivateSubnets[1].ID().ToStringOutput(),
-			},
+			SubnetIds: append(subnetIDs(d.VPC.Out.PublicSubnets), subnetIDs(d.VPC.Out.PrivateSubnets)...),
 			Tags: pulumi.StringMap{
 				"Name": pulumi.String(dbSubnetName),
 			},
-		}, pulumi.DependsOn([]pulumi.Resource{
-			d.VPC.Out.PublicSubnets[0], d.VPC.Out.PublicSubnets[1],
-			d.VPC.Out.PrivateSubnets[0], d.VPC.Out.PrivateSubnets[1],
-		}),
+		}, pulumi.DependsOn(subnetResources(append(d.VPC.Out.PublicSubnets, d.VPC.Out.PrivateSubnets...))),
 		)
 		if err != nil {
 			return err
@@ -93,6 +118,9 @@ func (d *Postgres) Run(ctx *pulumi.Context, opts ...pulumi.ResourceOption) error
 	}
 
 	d.Out.DB = database
+	d.Exports.export(ctx, d.Name, "DB-ARN", database.Arn)
+	d.Exports.export(ctx, d.Name, "DB-ENDPOINT", database.Endpoint)
+	d.Exports.export(ctx, d.Name, "DB-ADDRESS", database.Address)
 
 	return nil
 }
@@ -1,11 +1,25 @@
 package aws
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/moby/patternmatcher"
+	"github.com/moby/patternmatcher/ignorefile"
 	"github.com/pulumi/pulumi-aws/sdk/v5/go/aws/ecr"
+	awssdk "github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/kms"
+	"github.com/pulumi/pulumi-command/sdk/go/command/local"
 	"github.com/pulumi/pulumi-docker/sdk/v4/go/docker"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 )
@@ -14,9 +28,100 @@ type Docker struct {
 	Name   string
 	Docker *docker.DockerBuildArgs
 
+	// Platforms builds the image for each platform, i.e. linux/amd64 and
+	// linux/arm64. With more than one platform each image is pushed with the
+	// architecture appended to its tag and a multi-architecture manifest list
+	// referencing them is pushed with the image tag.
+	Platforms []string
+
+	// Registry pushes to an existing ECR repository or a non-ECR registry
+	// instead of creating an ECR repository.
+	Registry *Registry
+
+	// Lifecycle expires old images from the repository.
+	Lifecycle *LifecyclePolicy
+
+	// Policy grants other accounts and services pull access to the repository.
+	Policy *RepositoryPolicy
+
+	// KMS encrypts the repository with a customer managed key.
+	KMS *RepositoryKMS
+
+	// Cache reuses layers from previous builds.
+	Cache *BuildCache
+
+	// ScanGate fails the deployment when the scan of the pushed image has
+	// too many findings.
+	ScanGate *ScanGate
+
+	// GitSHA is the commit the image is built from. Defaults to the HEAD of
+	// the git repository containing the build context.
+	GitSHA string
+
+	// Exports namespaces or disables the image's stack exports.
+	Exports *Exports
+
 	Out struct {
-		Repo  *ecr.Repository
-		Image *docker.Image
+		// Repo is only set when the repository is created, i.e. without a Registry.
+		Repo      *ecr.Repository
+		CacheRepo *ecr.Repository
+		Key       *kms.Key
+
+		// Image and Images are the pushed docker.Images, Builds the buildx
+		// commands pushing them instead with a Cache.
+		Image  *docker.Image
+		Images []*docker.Image
+		Builds []*local.Command
+
+		// Manifest pushes the manifest list of a multi-platform image.
+		Manifest *local.Command
+
+		// ScanGates wait for the scans of the pushed platform images.
+		ScanGates []*local.Command
+
+		// RepoDigests are the pushed platform images.
+		RepoDigests []pulumi.StringOutput
+
+		// Tag is the commit SHA plus a content hash of the build context, or
+		// latest when Context or Dockerfile aren't known up front.
+		Tag string
+
+		// ImageName is the pushed digest task definitions should run.
+		ImageName pulumi.StringOutput
+
+		// RepositoryURL is the repository the image is pushed to.
+		RepositoryURL pulumi.StringOutput
+
+		// RepositoryCredentials is the ARN of the secret ECS pulls the image
+		// with from a non-ECR registry. It is nil for ECR.
+		RepositoryCredentials pulumi.StringInput
+	}
+}
+
+// DockerOutputs are the image values other stacks consume, i.e. to run the
+// same image.
+type DockerOutputs struct {
+	ImageName     pulumi.StringOutput
+	Tag           pulumi.StringOutput
+	RepositoryURL pulumi.StringOutput
+}
+
+// Outputs returns the image's outputs once it has been run.
+func (d *Docker) Outputs() *DockerOutputs {
+	return &DockerOutputs{
+		ImageName:     d.Out.ImageName,
+		Tag:           pulumi.String(d.Out.Tag).ToStringOutput(),
+		RepositoryURL: d.Out.RepositoryURL,
+	}
+}
+
+// DockerOutputsFromStack reads the outputs of the named image from the stack
+// that deployed it, which must have been deployed with the same Exports.
+func DockerOutputsFromStack(ref *pulumi.StackReference, name string, exports *Exports) *DockerOutputs {
+	return &DockerOutputs{
+		ImageName:     exports.stringOutput(ref, name, "IMAGE-NAME"),
+		Tag:           exports.stringOutput(ref, name, "IMAGE-TAG"),
+		RepositoryURL: exports.stringOutput(ref, name, "IMAGE-REPOSITORY-URL"),
 	}
 }
 
@@ -29,6 +134,56 @@ func (d *Docker) Validate() error {
 		return fmt.Errorf("Missing docker.Docker args")
 	}
 
+	if d.Lifecycle != nil {
+		if err := d.Lifecycle.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if d.Policy != nil {
+		if err := d.Policy.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if d.Registry != nil {
+		if err := d.Registry.Validate(); err != nil {
+			return err
+		}
+
+		if d.Lifecycle != nil || d.Policy != nil || d.KMS != nil {
+			return fmt.Errorf("Docker.Lifecycle, Docker.Policy and Docker.KMS can only be set on a created repository, not a Registry")
+		}
+
+		if !d.Registry.isECR() && (d.Cache != nil || d.ScanGate != nil) {
+			return fmt.Errorf("Docker.Cache and Docker.ScanGate require an ECR repository")
+		}
+	}
+
+	if d.KMS != nil {
+		if err := d.KMS.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if d.Cache != nil {
+		if err := d.Cache.Validate(d.Docker); err != nil {
+			return err
+		}
+	}
+
+	if d.ScanGate != nil {
+		if err := d.ScanGate.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, platform := range d.Platforms {
+		if !strings.HasPrefix(platform, "linux/") {
+			return fmt.Errorf("Docker.Platforms <%v> is invalid - must be a linux platform, i.e. <linux/arm64>", platform)
+		}
+	}
+
 	return nil
 }
 
@@ -37,27 +192,281 @@ func (d *Docker) Run(ctx *pulumi.Context, opts ...pulumi.ResourceOption) error {
 		return err
 	}
 
-	// Create docker repo
+	tag, err := imageTag(d.Docker, d.Platforms, d.GitSHA)
+	if err != nil {
+		return err
+	}
+	d.Out.Tag = tag
+
+	repoURL, repoUser, repoPass, err := d.registry(ctx, opts...)
+	if err != nil {
+		return err
+	}
+
+	d.Out.RepositoryURL = repoURL.ToStringOutput()
+	d.Exports.export(ctx, d.Name, "IMAGE-REPOSITORY-URL", repoURL)
+	d.Exports.export(ctx, d.Name, "IMAGE-TAG", pulumi.String(tag))
+
+	registry := docker.RegistryArgs{
+		Server:   repoURL,
+		Username: repoUser,
+		Password: repoPass,
+	}
+
+	if err := d.cacheRepository(ctx, opts...); err != nil {
+		return err
+	}
+
+	if len(d.Platforms) <= 1 {
+		platform := ""
+		if len(d.Platforms) == 1 {
+			platform = d.Platforms[0]
+		}
+
+		// Create image
+		digest, err := d.pushImage(ctx, d.Name, platform, "", pulumi.Sprintf("%s:%s", repoURL, tag), registry, opts...)
+		if err != nil {
+			return err
+		}
+		d.Out.ImageName = digest
+
+		if err := d.gateOnScan(ctx, opts...); err != nil {
+			return err
+		}
+		d.Exports.export(ctx, d.Name, "IMAGE-NAME", d.Out.ImageName)
+
+		return nil
+	}
+
+	// Create an image per platform
+	digests := []pulumi.StringOutput{}
+	for _, platform := range d.Platforms {
+		arch := platform[strings.LastIndex(platform, "/")+1:]
+
+		digest, err := d.pushImage(ctx, fmt.Sprintf("%v-%v", d.Name, arch), platform, arch, pulumi.Sprintf("%s:%s-%s", repoURL, tag, arch), registry, opts...)
+		if err != nil {
+			return err
+		}
+		digests = append(digests, digest)
+	}
+
+	// Push the manifest list once every platform image has been pushed.
+	imageName, err := d.pushManifestList(ctx, pulumi.Sprintf("%s:%s", repoURL, tag), registry, digests, opts...)
+	if err != nil {
+		return err
+	}
+	d.Out.ImageName = imageName
+
+	if err := d.gateOnScan(ctx, opts...); err != nil {
+		return err
+	}
+	d.Exports.export(ctx, d.Name, "IMAGE-NAME", d.Out.ImageName)
+
+	return nil
+}
+
+// pushImage builds and pushes the image for the platform, returning its repo
+// digest. Cached builds run with buildx, others as a docker.Image.
+func (d *Docker) pushImage(ctx *pulumi.Context, name, platform, arch string, imageName pulumi.StringOutput, registry docker.RegistryArgs, opts ...pulumi.ResourceOption) (pulumi.StringOutput, error) {
+	if d.Out.CacheRepo != nil {
+		return d.cachedBuild(ctx, name, platform, arch, imageName, registry, opts...)
+	}
+
+	build := *d.Docker
+	if platform != "" {
+		build.Platform = pulumi.String(platform)
+	}
+
+	image, err := docker.NewImage(ctx, name, &docker.ImageArgs{
+		Build:     build,
+		ImageName: imageName,
+		Registry:  registry,
+	}, opts...)
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+
+	if d.Out.Image == nil {
+		d.Out.Image = image
+	}
+	d.Out.Images = append(d.Out.Images, image)
+	d.Out.RepoDigests = append(d.Out.RepoDigests, image.RepoDigest)
+
+	return image.RepoDigest, nil
+}
+
+// gateOnScan resolves ImageName only once the scans of the pushed platform
+// images pass the ScanGate.
+func (d *Docker) gateOnScan(ctx *pulumi.Context, opts ...pulumi.ResourceOption) error {
+	if d.ScanGate == nil {
+		return nil
+	}
+
+	args := []interface{}{d.Out.ImageName}
+	for idx, digest := range d.Out.RepoDigests {
+		gated, command, err := d.ScanGate.Run(ctx, fmt.Sprintf("%v-scan-gate-%d", d.Name, idx+1), digest, opts...)
+		if err != nil {
+			return err
+		}
+		d.Out.ScanGates = append(d.Out.ScanGates, command)
+		args = append(args, gated)
+	}
+
+	d.Out.ImageName = pulumi.All(args...).ApplyT(func(args []interface{}) string {
+		return args[0].(string)
+	}).(pulumi.StringOutput)
+
+	return nil
+}
+
+// imagesPerPush is the number of tagged images a deployment pushes, one per
+// platform plus the manifest list referencing them.
+func (d *Docker) imagesPerPush() int {
+	if len(d.Platforms) <= 1 {
+		return 1
+	}
+
+	return len(d.Platforms) + 1
+}
+
+// tagMutability is IMMUTABLE unless the image is pushed with fallbackImageTag.
+func (d *Docker) tagMutability() string {
+	if d.Out.Tag == fallbackImageTag {
+		return "MUTABLE"
+	}
+
+	return "IMMUTABLE"
+}
+
+// ecrRepository creates the image repository along with its lifecycle and
+// repository policies.
+func (d *Docker) ecrRepository(ctx *pulumi.Context, opts ...pulumi.ResourceOption) (*ecr.Repository, error) {
+	encryption, err := d.encryptionConfigurations(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
 	repo, err := ecr.NewRepository(ctx, d.Name, &ecr.RepositoryArgs{
-		Name: pulumi.String(d.Name),
-		EncryptionConfigurations: ecr.RepositoryEncryptionConfigurationArray{
-			&ecr.RepositoryEncryptionConfigurationArgs{
-				EncryptionType: pulumi.String("AES256"),
-			},
-		},
-		ImageTagMutability: pulumi.String("MUTABLE"),
+		Name:                     pulumi.String(d.Name),
+		EncryptionConfigurations: encryption,
+		ImageTagMutability:       pulumi.String(d.tagMutability()),
 		ImageScanningConfiguration: &ecr.RepositoryImageScanningConfigurationArgs{
 			ScanOnPush: pulumi.Bool(true),
 		},
 	}, opts...)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if d.Lifecycle != nil {
+		_, err = ecr.NewLifecyclePolicy(ctx, fmt.Sprintf("%v-lifecycle", d.Name), &ecr.LifecyclePolicyArgs{
+			Repository: repo.Name,
+			Policy:     pulumi.String(d.Lifecycle.policy(d.imagesPerPush())),
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if d.Policy != nil {
+		_, err = ecr.NewRepositoryPolicy(ctx, fmt.Sprintf("%v-policy", d.Name), &ecr.RepositoryPolicyArgs{
+			Repository: repo.Name,
+			Policy:     pulumi.String(d.Policy.Policy()),
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	d.Out.Repo = repo
+	return repo, nil
+}
 
-	// Get repository credentials
-	repoCreds := repo.RegistryId.ApplyT(func(rid string) ([]string, error) {
+// encryptionConfigurations returns the repository encryption, creating the
+// KMS key when needed. Repositories default to AES256.
+func (d *Docker) encryptionConfigurations(ctx *pulumi.Context, opts ...pulumi.ResourceOption) (ecr.RepositoryEncryptionConfigurationArray, error) {
+	if d.KMS == nil {
+		return ecr.RepositoryEncryptionConfigurationArray{
+			&ecr.RepositoryEncryptionConfigurationArgs{
+				EncryptionType: pulumi.String("AES256"),
+			},
+		}, nil
+	}
+
+	keyArn := d.KMS.KeyArn
+	if d.KMS.CreateKey && d.Out.Key == nil {
+		identity, err := awssdk.GetCallerIdentity(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		region, err := awssdk.GetRegion(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		decryptRoleArns := d.KMS.DecryptRoleArns
+		if decryptRoleArns == nil {
+			decryptRoleArns = pulumi.StringArray{}
+		}
+
+		key, err := kms.NewKey(ctx, fmt.Sprintf("%v-repo-key", d.Name), &kms.KeyArgs{
+			Description:          pulumi.String(fmt.Sprintf("%v KMS encryption key for ECR", d.Name)),
+			DeletionWindowInDays: pulumi.Int(7),
+			EnableKeyRotation:    pulumi.Bool(true),
+			Policy: decryptRoleArns.ToStringArrayOutput().ApplyT(func(roleArns []string) string {
+				return ecrKeyPolicy(identity.AccountId, region.Name, roleArns)
+			}).(pulumi.StringOutput),
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+		d.Out.Key = key
+	}
+
+	if d.Out.Key != nil {
+		keyArn = d.Out.Key.Arn
+	}
+
+	return ecr.RepositoryEncryptionConfigurationArray{
+		&ecr.RepositoryEncryptionConfigurationArgs{
+			EncryptionType: pulumi.String("KMS"),
+			KmsKey:         keyArn,
+		},
+	}, nil
+}
+
+// imagePullPolicy allows the task execution role to read the credentials ECS
+// pulls the image with from a non-ECR registry and to decrypt images encrypted
+// with an existing KMS key.
+func imagePullPolicy(ctx *pulumi.Context, name string, executionRoleArn pulumi.StringPtrInput, d *Docker, opts ...pulumi.ResourceOption) error {
+	permissions := []Permission{}
+	if d.Out.RepositoryCredentials != nil {
+		permissions = append(permissions, ReadSecret(d.Out.RepositoryCredentials))
+	}
+
+	if d.KMS != nil && d.KMS.KeyArn != nil {
+		permissions = append(permissions, Permission{
+			Actions:   []string{"kms:Decrypt"},
+			Resources: pulumi.StringArray{d.KMS.KeyArn},
+		})
+	}
+
+	if len(permissions) == 0 || executionRoleArn == nil {
+		return nil
+	}
+
+	_, err := iam.NewRolePolicy(ctx, fmt.Sprintf("%v-image-pull-policy", name), &iam.RolePolicyArgs{
+		Role:   roleName(executionRoleArn),
+		Policy: PolicyDocument(permissions),
+	}, opts...)
+
+	return err
+}
+
+// ecrCredentials returns the username and password of a temporary ECR
+// authorization token for the registry.
+func ecrCredentials(ctx *pulumi.Context, registryID pulumi.StringInput) (pulumi.StringOutput, pulumi.StringOutput) {
+	repoCreds := registryID.ToStringOutput().ApplyT(func(rid string) ([]string, error) {
 		creds, err := ecr.GetCredentials(ctx, &ecr.GetCredentialsArgs{
 			RegistryId: rid,
 		})
@@ -71,24 +480,211 @@ func (d *Docker) Run(ctx *pulumi.Context, opts ...pulumi.ResourceOption) error {
 		return strings.Split(string(data), ":"), nil
 	}).(pulumi.StringArrayOutput)
 
-	repoUser := repoCreds.Index(pulumi.Int(0))
-	repoPass := repoCreds.Index(pulumi.Int(1))
-
-	// Create image
-	image, err := docker.NewImage(ctx, d.Name, &docker.ImageArgs{
-		Build:     *d.Docker,
-		ImageName: repo.RepositoryUrl,
-		Registry: docker.RegistryArgs{
-			Server:   repo.RepositoryUrl,
-			Username: repoUser,
-			Password: repoPass,
+	return repoCreds.Index(pulumi.Int(0)), repoCreds.Index(pulumi.Int(1))
+}
+
+// manifestListScript logs in to the registry and pushes a manifest list
+// referencing the platform images, printing only its digest. An existing
+// manifest list is left alone unless the tag is mutable.
+const manifestListScript = `set -euo pipefail
+echo "$REGISTRY_PASSWORD" | docker login --username "$REGISTRY_USERNAME" --password-stdin "$REGISTRY_SERVER" >&2
+if [ "$MUTABLE" != "true" ] && digest=$(docker buildx imagetools inspect "$IMAGE" --format '{{.Manifest.Digest}}' 2>/dev/null); then
+	echo "$digest"
+	exit 0
+fi
+docker buildx imagetools create --tag "$IMAGE" $IMAGES >&2
+docker buildx imagetools inspect "$IMAGE" --format '{{.Manifest.Digest}}'
+`
+
+// pushManifestList pushes the manifest list tagged as imageName referencing
+// the platform images' repo digests, returning its own repo digest. It is
+// pushed again whenever a platform image changes.
+func (d *Docker) pushManifestList(ctx *pulumi.Context, imageName pulumi.StringOutput, registry docker.RegistryArgs, digests []pulumi.StringOutput, opts ...pulumi.ResourceOption) (pulumi.StringOutput, error) {
+	images := pulumi.StringArray{}
+	triggers := pulumi.Array{}
+	for _, digest := range digests {
+		images = append(images, digest)
+		triggers = append(triggers, digest)
+	}
+
+	manifest, err := local.NewCommand(ctx, fmt.Sprintf("%v-manifest", d.Name), &local.CommandArgs{
+		Create:      pulumi.String(manifestListScript),
+		Interpreter: pulumi.StringArray{pulumi.String("/bin/bash"), pulumi.String("-c")},
+		Environment: pulumi.StringMap{
+			"IMAGE":             imageName,
+			"IMAGES":            images.ToStringArrayOutput().ApplyT(func(images []string) string { return strings.Join(images, " ") }).(pulumi.StringOutput),
+			"MUTABLE":           pulumi.Sprintf("%t", d.Out.Tag == fallbackImageTag),
+			"REGISTRY_SERVER":   registryServer(registry.Server),
+			"REGISTRY_USERNAME": registry.Username.ToStringPtrOutput().Elem(),
+			"REGISTRY_PASSWORD": registry.Password.ToStringPtrOutput().Elem(),
 		},
+		Triggers: triggers,
 	}, opts...)
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+	d.Out.Manifest = manifest
+
+	return pulumi.All(imageName, manifest.Stdout).ApplyT(func(args []interface{}) string {
+		repo := args[0].(string)
+		return fmt.Sprintf("%v@%v", repo[:strings.LastIndex(repo, ":")], strings.TrimSpace(args[1].(string)))
+	}).(pulumi.StringOutput), nil
+}
+
+// registryServer is the host of the registry's repository URL.
+func registryServer(server pulumi.StringPtrInput) pulumi.StringOutput {
+	return server.ToStringPtrOutput().Elem().ApplyT(func(repoURL string) string {
+		return strings.SplitN(repoURL, "/", 2)[0]
+	}).(pulumi.StringOutput)
+}
+
+// fallbackImageTag is pushed when the build inputs can't be hashed, in which
+// case the created repository's tags are mutable.
+const fallbackImageTag = "latest"
+
+// imageTag returns the git commit SHA plus a content hash of the build
+// context, Dockerfile and build settings, so a tag always names one image.
+// Files excluded by the context's .dockerignore aren't hashed. Without GitSHA
+// or a git checkout the tag is the content hash alone, and fallbackImageTag
+// when Context or Dockerfile isn't a pulumi.String.
+func imageTag(build *docker.DockerBuildArgs, platforms []string, gitSHA string) (string, error) {
+	buildContext := "."
+	if build.Context != nil {
+		value, ok := build.Context.(pulumi.String)
+		if !ok {
+			return fallbackImageTag, nil
+		}
+		buildContext = string(value)
+	}
+
+	dockerfile := ""
+	if build.Dockerfile != nil {
+		value, ok := build.Dockerfile.(pulumi.String)
+		if !ok {
+			return fallbackImageTag, nil
+		}
+		dockerfile = string(value)
+	}
+
+	ignore, err := dockerignore(buildContext)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	err = filepath.WalkDir(buildContext, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(buildContext, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if entry.IsDir() && entry.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		excluded, err := ignore.MatchesOrParentMatches(rel)
+		if err != nil {
+			return err
+		}
+
+		if excluded {
+			// Exclusions may re-include files below an excluded directory.
+			if entry.IsDir() && !ignore.Exclusions() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		return hashFile(hash, rel, path)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// The Dockerfile may live outside of the context.
+	if dockerfile != "" {
+		if err := hashFile(hash, "Dockerfile", dockerfile); err != nil {
+			return "", err
+		}
+	}
+
+	if args, ok := build.Args.(pulumi.StringMap); ok {
+		keys := make([]string, 0, len(args))
+		for key := range args {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if value, ok := args[key].(pulumi.String); ok {
+				fmt.Fprintf(hash, "arg:%v=%v\n", key, value)
+			}
+		}
+	}
+
+	if target, ok := build.Target.(pulumi.String); ok {
+		fmt.Fprintf(hash, "target:%v\n", target)
+	}
+
+	fmt.Fprintf(hash, "platforms:%v\n", strings.Join(platforms, ","))
+
+	contentHash := hex.EncodeToString(hash.Sum(nil))[:12]
+
+	if gitSHA == "" {
+		if out, err := exec.Command("git", "-C", buildContext, "rev-parse", "HEAD").Output(); err == nil {
+			gitSHA = strings.TrimSpace(string(out))
+		}
+	}
+
+	if gitSHA == "" {
+		return contentHash, nil
+	}
+
+	if len(gitSHA) > 12 {
+		gitSHA = gitSHA[:12]
+	}
+
+	return fmt.Sprintf("%v-%v", gitSHA, contentHash), nil
+}
+
+// dockerignore returns the matcher for the context's .dockerignore patterns,
+// which matches nothing when there's no .dockerignore.
+func dockerignore(buildContext string) (*patternmatcher.PatternMatcher, error) {
+	f, err := os.Open(filepath.Join(buildContext, ".dockerignore"))
+	if os.IsNotExist(err) {
+		return patternmatcher.New(nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	patterns, err := ignorefile.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %v: %v", f.Name(), err)
+	}
+
+	return patternmatcher.New(patterns)
+}
+
+func hashFile(hash io.Writer, name, path string) error {
+	f, err := os.Open(path)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
 
-	d.Out.Image = image
+	fmt.Fprintf(hash, "file:%v\n", filepath.ToSlash(name))
+	_, err = io.Copy(hash, f)
 
-	return nil
+	return err
 }
@@ -0,0 +1,193 @@
+package aws
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pulumi/pulumi-aws/sdk/v5/go/aws/ecr"
+	"github.com/pulumi/pulumi-command/sdk/go/command/local"
+	"github.com/pulumi/pulumi-docker/sdk/v4/go/docker"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// cacheBuilder is the buildx builder cached builds run in. Exporting a
+// registry cache needs the docker-container driver.
+const cacheBuilder = "pulumi-deploy"
+
+// BuildCache exports BuildKit's layer cache, including the layers of
+// intermediate build stages, to a separate mutable <name>-cache repository and
+// builds from it, so builds on fresh CI runners don't start from scratch.
+// Cached builds run `docker buildx build` where Pulumi runs.
+type BuildCache struct {
+	// Disabled turns caching off, i.e. for release builds.
+	Disabled bool
+
+	// Tag defaults to buildcache. Multi-platform builds cache each platform
+	// under Tag-<arch>.
+	Tag string
+}
+
+func (c *BuildCache) Validate(build *docker.DockerBuildArgs) error {
+	if c.Tag == "" {
+		c.Tag = "buildcache"
+	}
+
+	if _, ok := build.Args.(pulumi.StringMap); build.Args != nil && !ok {
+		return fmt.Errorf("docker.Docker.Args must be a pulumi.StringMap to enable the build cache")
+	}
+
+	if build.CacheFrom != nil {
+		return fmt.Errorf("docker.Docker.CacheFrom cannot be combined with Docker.Cache")
+	}
+
+	return nil
+}
+
+// cacheRepository creates the repository the build cache is exported to,
+// unless caching is disabled.
+func (d *Docker) cacheRepository(ctx *pulumi.Context, opts ...pulumi.ResourceOption) error {
+	if d.Cache == nil || d.Cache.Disabled {
+		return nil
+	}
+
+	cacheRepoName := fmt.Sprintf("%v-cache", d.Name)
+	encryption, err := d.encryptionConfigurations(ctx, opts...)
+	if err != nil {
+		return err
+	}
+
+	cacheRepo, err := ecr.NewRepository(ctx, cacheRepoName, &ecr.RepositoryArgs{
+		Name:                     pulumi.String(cacheRepoName),
+		EncryptionConfigurations: encryption,
+		ImageTagMutability:       pulumi.String("MUTABLE"),
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	d.Out.CacheRepo = cacheRepo
+
+	// Cache tags are moved on every push, leaving the previous images untagged.
+	_, err = ecr.NewLifecyclePolicy(ctx, fmt.Sprintf("%v-lifecycle", cacheRepoName), &ecr.LifecyclePolicyArgs{
+		Repository: cacheRepo.Name,
+		Policy:     pulumi.String((&LifecyclePolicy{ExpireUntaggedDays: 1}).Policy()),
+	}, opts...)
+
+	return err
+}
+
+// cachedBuildScript logs in to the registry, makes sure the builder exists and
+// runs the build, printing only the pushed image's digest.
+const cachedBuildScript = `set -euo pipefail
+echo "$REGISTRY_PASSWORD" | docker login --username "$REGISTRY_USERNAME" --password-stdin "$REGISTRY_SERVER" >&2
+docker buildx inspect %[1]v >/dev/null 2>&1 || docker buildx create --name %[1]v --driver docker-container >&2
+%[2]v >&2
+docker buildx imagetools inspect "$IMAGE" --format '{{.Manifest.Digest}}'
+`
+
+// cachedBuild builds and pushes the image with buildx, reading and exporting
+// the registry cache with mode=max. The build reruns whenever the image name
+// or build settings change, i.e. on a new content-addressed tag.
+func (d *Docker) cachedBuild(ctx *pulumi.Context, name, platform, arch string, imageName pulumi.StringOutput, registry docker.RegistryArgs, opts ...pulumi.ResourceOption) (pulumi.StringOutput, error) {
+	cacheRef := pulumi.Sprintf("%s:%s", d.Out.CacheRepo.RepositoryUrl, d.Cache.Tag)
+	if arch != "" {
+		cacheRef = pulumi.Sprintf("%s-%s", cacheRef, arch)
+	}
+
+	var args pulumi.StringMapInput = pulumi.StringMap{}
+	if d.Docker.Args != nil {
+		args = d.Docker.Args
+	}
+
+	create := pulumi.All(imageName, cacheRef, optionalString(d.Docker.Context), optionalString(d.Docker.Dockerfile),
+		optionalString(d.Docker.Target), args.ToStringMapOutput()).ApplyT(func(args []interface{}) string {
+		build := buildxCommand(args[0].(string), args[1].(string), platform, args[2].(string), args[3].(string), args[4].(string), args[5].(map[string]string))
+
+		return fmt.Sprintf(cachedBuildScript, cacheBuilder, build)
+	}).(pulumi.StringOutput)
+
+	build, err := local.NewCommand(ctx, fmt.Sprintf("%v-build", name), &local.CommandArgs{
+		Create:      create,
+		Interpreter: pulumi.StringArray{pulumi.String("/bin/bash"), pulumi.String("-c")},
+		Environment: pulumi.StringMap{
+			"IMAGE":             imageName,
+			"REGISTRY_SERVER":   registryServer(registry.Server),
+			"REGISTRY_USERNAME": registry.Username.ToStringPtrOutput().Elem(),
+			"REGISTRY_PASSWORD": registry.Password.ToStringPtrOutput().Elem(),
+		},
+		Triggers: pulumi.Array{imageName},
+	}, append(opts, pulumi.DependsOn([]pulumi.Resource{d.Out.CacheRepo}))...)
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+	d.Out.Builds = append(d.Out.Builds, build)
+
+	repoDigest := pulumi.All(imageName, build.Stdout).ApplyT(func(args []interface{}) string {
+		repo := args[0].(string)
+		return fmt.Sprintf("%v@%v", repo[:strings.LastIndex(repo, ":")], strings.TrimSpace(args[1].(string)))
+	}).(pulumi.StringOutput)
+	d.Out.RepoDigests = append(d.Out.RepoDigests, repoDigest)
+
+	return repoDigest, nil
+}
+
+// buildxCommand renders the buildx build pushing image, caching from and to
+// cacheRef. Provenance is disabled so a single platform pushes an image
+// manifest rather than an index.
+func buildxCommand(image, cacheRef, platform, context, dockerfile, target string, args map[string]string) string {
+	argv := []string{"docker", "buildx", "build", "--builder", cacheBuilder, "--push", "--provenance=false"}
+
+	if platform != "" {
+		argv = append(argv, "--platform", platform)
+	}
+
+	if dockerfile != "" {
+		argv = append(argv, "--file", dockerfile)
+	}
+
+	if target != "" {
+		argv = append(argv, "--target", target)
+	}
+
+	keys := make([]string, 0, len(args))
+	for key := range args {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		argv = append(argv, "--build-arg", fmt.Sprintf("%v=%v", key, args[key]))
+	}
+
+	if context == "" {
+		context = "."
+	}
+
+	argv = append(argv,
+		"--cache-from", fmt.Sprintf("type=registry,ref=%v", cacheRef),
+		"--cache-to", fmt.Sprintf("type=registry,ref=%v,mode=max,image-manifest=true,oci-mediatypes=true", cacheRef),
+		"--tag", image,
+		context,
+	)
+
+	quoted := make([]string, len(argv))
+	for idx, arg := range argv {
+		quoted[idx] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// optionalString resolves an optional input to its value or an empty string.
+func optionalString(input pulumi.StringPtrInput) pulumi.StringOutput {
+	if input == nil {
+		return pulumi.String("").ToStringOutput()
+	}
+
+	return input.ToStringPtrOutput().ApplyT(func(value *string) string {
+		if value == nil {
+			return ""
+		}
+		return *value
+	}).(pulumi.StringOutput)
+}
@@ -0,0 +1,143 @@
+package aws
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/pulumi/pulumi-docker/sdk/v4/go/docker"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	assert "github.com/stretchr/testify/require"
+)
+
+func writeBuildContext(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+}
+
+func TestImageTag(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		build  func(dir string) *docker.DockerBuildArgs
+		gitSHA string
+		want   string
+	}{
+		{
+			name:  "Test imageTag falls back to latest for a non-literal context",
+			files: map[string]string{"Dockerfile": "FROM scratch"},
+			build: func(dir string) *docker.DockerBuildArgs {
+				return &docker.DockerBuildArgs{Context: pulumi.String(dir).ToStringOutput()}
+			},
+			want: "^latest$",
+		},
+		{
+			name:  "Test imageTag falls back to latest for a non-literal Dockerfile",
+			files: map[string]string{"Dockerfile": "FROM scratch"},
+			build: func(dir string) *docker.DockerBuildArgs {
+				return &docker.DockerBuildArgs{
+					Context:    pulumi.String(dir),
+					Dockerfile: pulumi.String(filepath.Join(dir, "Dockerfile")).ToStringOutput(),
+				}
+			},
+			want: "^latest$",
+		},
+		{
+			name:  "Test imageTag prefixes the content hash with the short git SHA",
+			files: map[string]string{"Dockerfile": "FROM scratch"},
+			build: func(dir string) *docker.DockerBuildArgs {
+				return &docker.DockerBuildArgs{Context: pulumi.String(dir)}
+			},
+			gitSHA: "0123456789abcdef0123",
+			want:   "^0123456789ab-[0-9a-f]{12}$",
+		},
+		{
+			name:  "Test imageTag is the content hash alone outside of a git checkout",
+			files: map[string]string{"Dockerfile": "FROM scratch"},
+			build: func(dir string) *docker.DockerBuildArgs {
+				return &docker.DockerBuildArgs{Context: pulumi.String(dir)}
+			},
+			want: "^[0-9a-f]{12}$",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeBuildContext(t, dir, tt.files)
+
+			tag, err := imageTag(tt.build(dir), nil, tt.gitSHA)
+			assert.NoError(t, err)
+			assert.Regexp(t, regexp.MustCompile(tt.want), tag)
+		})
+	}
+}
+
+func TestImageTag_dockerignore(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		changed  map[string]string
+		wantSame bool
+	}{
+		{
+			name: "Test imageTag changes with a file in the context",
+			files: map[string]string{
+				"Dockerfile": "FROM scratch",
+				"main.go":    "package main",
+			},
+			changed:  map[string]string{"main.go": "package main\n\nfunc main() {}"},
+			wantSame: false,
+		},
+		{
+			name: "Test imageTag ignores a directory excluded by .dockerignore",
+			files: map[string]string{
+				".dockerignore":         "node_modules\n.git\n",
+				"Dockerfile":            "FROM scratch",
+				"node_modules/a/a.js":   "a",
+				"node_modules/b/b.json": "{}",
+			},
+			changed:  map[string]string{"node_modules/a/a.js": "b", "node_modules/c.js": "c"},
+			wantSame: true,
+		},
+		{
+			name: "Test imageTag ignores files matching a .dockerignore wildcard",
+			files: map[string]string{
+				".dockerignore": "**/*.log\n",
+				"Dockerfile":    "FROM scratch",
+				"logs/app.log":  "a",
+			},
+			changed:  map[string]string{"logs/app.log": "b", "debug.log": "c"},
+			wantSame: true,
+		},
+		{
+			name: "Test imageTag hashes files re-included by a .dockerignore exclusion",
+			files: map[string]string{
+				".dockerignore":  "build\n!build/keep.txt\n",
+				"Dockerfile":     "FROM scratch",
+				"build/keep.txt": "a",
+			},
+			changed:  map[string]string{"build/keep.txt": "b"},
+			wantSame: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeBuildContext(t, dir, tt.files)
+			build := &docker.DockerBuildArgs{Context: pulumi.String(dir)}
+
+			before, err := imageTag(build, nil, "abc")
+			assert.NoError(t, err)
+
+			writeBuildContext(t, dir, tt.changed)
+
+			after, err := imageTag(build, nil, "abc")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantSame, before == after)
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package aws
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/autoscaling"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ecs"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ssm"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// EC2Capacity registers an Auto Scaling group of ECS-optimized instances in
+// the VPC's private subnets as a cluster capacity provider, for workloads
+// Fargate can't run, i.e. daemon tasks, host networking or large memory.
+// Services use it through a capacity provider strategy naming
+// Out.CapacityProvider.
+type EC2Capacity struct {
+	VPC          *VPC
+	InstanceType string
+
+	// AMIParameter is the SSM parameter holding the AMI ID. Defaults to the
+	// recommended Amazon Linux 2023 ECS-optimized AMI, which is looked up on
+	// every deploy so new instances launch with the latest AMI.
+	AMIParameter string
+
+	// MinSize and MaxSize bound the group, which ECS managed scaling resizes.
+	MinSize int
+	MaxSize int
+
+	// TargetCapacity is the cluster utilization percentage managed scaling
+	// aims for. Defaults to 100, lower values keep spare instances warm.
+	TargetCapacity int
+
+	// RootVolumeSize in GiB. Defaults to 30.
+	RootVolumeSize int
+
+	// SecurityGroups defaults to a security group allowing all egress.
+	SecurityGroups pulumi.StringArrayInput
+
+	Out struct {
+		InstanceRole     *iam.Role
+		InstanceProfile  *iam.InstanceProfile
+		SecurityGroup    *ec2.SecurityGroup
+		LaunchTemplate   *ec2.LaunchTemplate
+		AutoScalingGroup *autoscaling.Group
+		CapacityProvider *ecs.CapacityProvider
+	}
+}
+
+func (c *EC2Capacity) Validate() error {
+	if c.VPC == nil {
+		return fmt.Errorf("missing EC2Capacity.VPC")
+	}
+
+	if c.VPC.Out.VPC == nil || len(c.VPC.Out.PrivateSubnets) == 0 {
+		return fmt.Errorf("EC2Capacity.VPC must be run first")
+	}
+
+	if c.InstanceType == "" {
+		return fmt.Errorf("missing EC2Capacity.InstanceType")
+	}
+
+	if c.AMIParameter == "" {
+		c.AMIParameter = "/aws/service/ecs/optimized-ami/amazon-linux-2023/recommended/image_id"
+	}
+
+	if c.MinSize < 0 {
+		return fmt.Errorf("EC2Capacity.MinSize cannot be negative")
+	}
+
+	if c.MaxSize < 1 || c.MaxSize < c.MinSize {
+		return fmt.Errorf("EC2Capacity.MaxSize must be at least 1 and at least EC2Capacity.MinSize")
+	}
+
+	if c.TargetCapacity == 0 {
+		c.TargetCapacity = 100
+	}
+
+	if c.TargetCapacity < 1 || c.TargetCapacity > 100 {
+		return fmt.Errorf("EC2Capacity.TargetCapacity must be between 1 and 100")
+	}
+
+	if c.RootVolumeSize == 0 {
+		c.RootVolumeSize = 30
+	}
+
+	return nil
+}
+
+// Run creates the instances' role, launch template, Auto Scaling group and
+// the capacity provider for the named cluster.
+func (c *EC2Capacity) Run(ctx *pulumi.Context, name string, cluster *ecs.Cluster, opts ...pulumi.ResourceOption) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	ami, err := ssm.LookupParameter(ctx, &ssm.LookupParameterArgs{
+		Name: c.AMIParameter,
+	})
+	if err != nil {
+		return err
+	}
+
+	roleName := fmt.Sprintf("%v-instance-role", name)
+	role, err := iam.NewRole(ctx, roleName, &iam.RoleArgs{
+		AssumeRolePolicy: pulumi.String(
+			`{
+				"Version": "2012-10-17",
+				"Statement": [{
+					"Sid": "",
+					"Effect": "Allow",
+					"Principal": {
+						"Service": "ec2.amazonaws.com"
+					},
+					"Action": "sts:AssumeRole"
+				}]
+			}`),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(roleName),
+		},
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	c.Out.InstanceRole = role
+
+	// Register with the cluster and allow Session Manager access to the instances.
+	for suffix, policyArn := range map[string]string{
+		"ecs": "arn:aws:iam::aws:policy/service-role/AmazonEC2ContainerServiceforEC2Role",
+		"ssm": "arn:aws:iam::aws:policy/AmazonSSMManagedInstanceCore",
+	} {
+		_, err = iam.NewRolePolicyAttachment(ctx, fmt.Sprintf("%v-instance-%v-policy", name, suffix), &iam.RolePolicyAttachmentArgs{
+			Role:      role.Name,
+			PolicyArn: pulumi.String(policyArn),
+		}, opts...)
+		if err != nil {
+			return err
+		}
+	}
+
+	profile, err := iam.NewInstanceProfile(ctx, fmt.Sprintf("%v-instance-profile", name), &iam.InstanceProfileArgs{
+		Role: role.Name,
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	c.Out.InstanceProfile = profile
+
+	securityGroups := c.SecurityGroups
+	if securityGroups == nil {
+		sgName := fmt.Sprintf("%v-instance-sg", name)
+		securityGroup, err := ec2.NewSecurityGroup(ctx, sgName, &ec2.SecurityGroupArgs{
+			VpcId: c.VPC.ID(),
+			Egress: ec2.SecurityGroupEgressArray{
+				ec2.SecurityGroupEgressArgs{
+					Protocol:   pulumi.String("-1"),
+					FromPort:   pulumi.Int(0),
+					ToPort:     pulumi.Int(0),
+					CidrBlocks: pulumi.StringArray{pulumi.String("0.0.0.0/0")},
+				},
+			},
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(sgName),
+			},
+		}, opts...)
+		if err != nil {
+			return err
+		}
+		c.Out.SecurityGroup = securityGroup
+		securityGroups = pulumi.StringArray{securityGroup.ID()}
+	}
+
+	userData := cluster.Name.ApplyT(func(clusterName string) string {
+		return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("#!/bin/bash\necho ECS_CLUSTER=%v >> /etc/ecs/ecs.config\n", clusterName)))
+	}).(pulumi.StringOutput)
+
+	templateName := fmt.Sprintf("%v-launch-template", name)
+	launchTemplate, err := ec2.NewLaunchTemplate(ctx, templateName, &ec2.LaunchTemplateArgs{
+		ImageId:      pulumi.String(ami.Value),
+		InstanceType: pulumi.String(c.InstanceType),
+		IamInstanceProfile: &ec2.LaunchTemplateIamInstanceProfileArgs{
+			Arn: profile.Arn,
+		},
+		VpcSecurityGroupIds: securityGroups,
+		UserData:            userData,
+		// Require IMDSv2, with a hop limit that lets bridge mode containers reach it.
+		MetadataOptions: &ec2.LaunchTemplateMetadataOptionsArgs{
+			HttpEndpoint:            pulumi.String("enabled"),
+			HttpTokens:              pulumi.String("required"),
+			HttpPutResponseHopLimit: pulumi.Int(2),
+		},
+		BlockDeviceMappings: ec2.LaunchTemplateBlockDeviceMappingArray{
+			&ec2.LaunchTemplateBlockDeviceMappingArgs{
+				DeviceName: pulumi.String("/dev/xvda"),
+				Ebs: &ec2.LaunchTemplateBlockDeviceMappingEbsArgs{
+					VolumeSize:          pulumi.Int(c.RootVolumeSize),
+					VolumeType:          pulumi.String("gp3"),
+					Encrypted:           pulumi.String("true"),
+					DeleteOnTermination: pulumi.String("true"),
+				},
+			},
+		},
+		TagSpecifications: ec2.LaunchTemplateTagSpecificationArray{
+			&ec2.LaunchTemplateTagSpecificationArgs{
+				ResourceType: pulumi.String("instance"),
+				Tags: pulumi.StringMap{
+					"Name": pulumi.String(fmt.Sprintf("%v-ecs-instance", name)),
+				},
+			},
+		},
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(templateName),
+		},
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	c.Out.LaunchTemplate = launchTemplate
+
+	subnets := pulumi.StringArray{}
+	for _, subnet := range c.VPC.Out.PrivateSubnets {
+		subnets = append(subnets, subnet.ID())
+	}
+
+	// Managed termination protection requires instances protected from scale
+	// in, so ECS decides which instances are drained. ECS owns the desired capacity.
+	group, err := autoscaling.NewGroup(ctx, fmt.Sprintf("%v-asg", name), &autoscaling.GroupArgs{
+		MinSize:            pulumi.Int(c.MinSize),
+		MaxSize:            pulumi.Int(c.MaxSize),
+		VpcZoneIdentifiers: subnets,
+		LaunchTemplate: &autoscaling.GroupLaunchTemplateArgs{
+			Id:      launchTemplate.ID(),
+			Version: pulumi.String("$Latest"),
+		},
+		ProtectFromScaleIn: pulumi.Bool(true),
+		Tags: autoscaling.GroupTagArray{
+			&autoscaling.GroupTagArgs{
+				Key:               pulumi.String("AmazonECSManaged"),
+				Value:             pulumi.String("true"),
+				PropagateAtLaunch: pulumi.Bool(true),
+			},
+		},
+	}, append(opts, pulumi.IgnoreChanges([]string{"desiredCapacity"}))...)
+	if err != nil {
+		return err
+	}
+	c.Out.AutoScalingGroup = group
+
+	providerName := fmt.Sprintf("%v-ec2", name)
+	provider, err := ecs.NewCapacityProvider(ctx, providerName, &ecs.CapacityProviderArgs{
+		Name: pulumi.String(providerName),
+		AutoScalingGroupProvider: &ecs.CapacityProviderAutoScalingGroupProviderArgs{
+			AutoScalingGroupArn:          group.Arn,
+			ManagedTerminationProtection: pulumi.String("ENABLED"),
+			ManagedScaling: &ecs.CapacityProviderAutoScalingGroupProviderManagedScalingArgs{
+				Status:                 pulumi.String("ENABLED"),
+				TargetCapacity:         pulumi.Int(c.TargetCapacity),
+				MinimumScalingStepSize: pulumi.Int(1),
+				MaximumScalingStepSize: pulumi.Int(10),
+			},
+		},
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(providerName),
+		},
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	c.Out.CapacityProvider = provider
+
+	return nil
+}
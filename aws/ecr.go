@@ -0,0 +1,268 @@
+package aws
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// maxRepositoryImages is ECR's per-repository image quota. A rule only expiring
+// images beyond it never expires any.
+const maxRepositoryImages = 20000
+
+// LifecyclePolicy expires images from a repository. Images with a tag
+// matching ProtectTagPatterns are never expired.
+type LifecyclePolicy struct {
+	// KeepTagged keeps the images of the most recent N pushes. A multi-platform
+	// push counts once, along with its platform images.
+	KeepTagged int
+
+	// ExpireUntaggedDays expires untagged images N days after they were pushed.
+	ExpireUntaggedDays int
+
+	// ProtectTagPatterns are tag patterns, with * wildcards, i.e. <release-*>.
+	ProtectTagPatterns []string
+}
+
+func (l *LifecyclePolicy) Validate() error {
+	if l.KeepTagged < 0 {
+		return fmt.Errorf("LifecyclePolicy.KeepTagged cannot be negative")
+	}
+
+	if l.ExpireUntaggedDays < 0 {
+		return fmt.Errorf("LifecyclePolicy.ExpireUntaggedDays cannot be negative")
+	}
+
+	if l.KeepTagged == 0 && l.ExpireUntaggedDays == 0 {
+		return fmt.Errorf("LifecyclePolicy must set KeepTagged or ExpireUntaggedDays")
+	}
+
+	return nil
+}
+
+type lifecycleRule struct {
+	RulePriority int                `json:"rulePriority"`
+	Description  string             `json:"description"`
+	Selection    lifecycleSelection `json:"selection"`
+	Action       lifecycleAction    `json:"action"`
+}
+
+type lifecycleSelection struct {
+	TagStatus      string   `json:"tagStatus"`
+	TagPatternList []string `json:"tagPatternList,omitempty"`
+	CountType      string   `json:"countType"`
+	CountUnit      string   `json:"countUnit,omitempty"`
+	CountNumber    int      `json:"countNumber"`
+}
+
+type lifecycleAction struct {
+	Type string `json:"type"`
+}
+
+// Policy renders the lifecycle policy document for a repository pushed one
+// image at a time.
+func (l *LifecyclePolicy) Policy() string {
+	return l.policy(1)
+}
+
+// policy renders the lifecycle policy document for a repository each push
+// adds imagesPerPush tagged images to, i.e. the platform images plus their
+// manifest list.
+func (l *LifecyclePolicy) policy(imagesPerPush int) string {
+	rules := []lifecycleRule{}
+
+	// An image matched by a rule can't be expired by a lower priority rule, so
+	// each protected pattern is matched first by a rule that can't expire any.
+	// Patterns get a rule each as an image must match every pattern of a rule.
+	for _, pattern := range l.ProtectTagPatterns {
+		rules = append(rules, lifecycleRule{
+			Description: fmt.Sprintf("Protect %v tags", pattern),
+			Selection: lifecycleSelection{
+				TagStatus:      "tagged",
+				TagPatternList: []string{pattern},
+				CountType:      "imageCountMoreThan",
+				CountNumber:    maxRepositoryImages,
+			},
+		})
+	}
+
+	if l.ExpireUntaggedDays > 0 {
+		rules = append(rules, lifecycleRule{
+			Description: fmt.Sprintf("Expire untagged images after %d days", l.ExpireUntaggedDays),
+			Selection: lifecycleSelection{
+				TagStatus:   "untagged",
+				CountType:   "sinceImagePushed",
+				CountUnit:   "days",
+				CountNumber: l.ExpireUntaggedDays,
+			},
+		})
+	}
+
+	if l.KeepTagged > 0 {
+		rules = append(rules, lifecycleRule{
+			Description: fmt.Sprintf("Keep the images of the last %d pushes", l.KeepTagged),
+			Selection: lifecycleSelection{
+				TagStatus:      "tagged",
+				TagPatternList: []string{"*"},
+				CountType:      "imageCountMoreThan",
+				CountNumber:    l.KeepTagged * imagesPerPush,
+			},
+		})
+	}
+
+	for idx := range rules {
+		rules[idx].RulePriority = idx + 1
+		rules[idx].Action = lifecycleAction{Type: "expire"}
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{"rules": rules})
+
+	return string(data)
+}
+
+// RepositoryPolicy grants other AWS accounts and services pull access to a repository.
+type RepositoryPolicy struct {
+	// PullAccounts are AWS account IDs allowed to pull images.
+	PullAccounts []string
+
+	// PullServices are service principals allowed to pull images, i.e. <lambda.amazonaws.com>.
+	PullServices []string
+}
+
+func (r *RepositoryPolicy) Validate() error {
+	if len(r.PullAccounts) == 0 && len(r.PullServices) == 0 {
+		return fmt.Errorf("RepositoryPolicy must set PullAccounts or PullServices")
+	}
+
+	for _, account := range r.PullAccounts {
+		if len(account) != 12 || strings.Trim(account, "0123456789") != "" {
+			return fmt.Errorf("RepositoryPolicy.PullAccounts <%v> is invalid - must be a 12 digit account ID", account)
+		}
+	}
+
+	return nil
+}
+
+// Policy renders the repository policy document.
+func (r *RepositoryPolicy) Policy() string {
+	pullActions := []string{"ecr:BatchGetImage", "ecr:GetDownloadUrlForLayer", "ecr:BatchCheckLayerAvailability"}
+	statements := []map[string]interface{}{}
+
+	if len(r.PullAccounts) > 0 {
+		principals := []string{}
+		for _, account := range r.PullAccounts {
+			principals = append(principals, fmt.Sprintf("arn:aws:iam::%v:root", account))
+		}
+
+		statements = append(statements, map[string]interface{}{
+			"Sid":       "CrossAccountPull",
+			"Effect":    "Allow",
+			"Principal": map[string]interface{}{"AWS": principals},
+			"Action":    pullActions,
+		})
+	}
+
+	if len(r.PullServices) > 0 {
+		statements = append(statements, map[string]interface{}{
+			"Sid":       "ServicePull",
+			"Effect":    "Allow",
+			"Principal": map[string]interface{}{"Service": r.PullServices},
+			"Action":    pullActions[:2],
+		})
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"Version":   "2012-10-17",
+		"Statement": statements,
+	})
+
+	return string(data)
+}
+
+// RepositoryKMS encrypts a repository with a customer managed KMS key instead
+// of AES256. A repository's encryption can't be changed, so setting it on an
+// existing repository replaces the repository.
+type RepositoryKMS struct {
+	// KeyArn is an existing key, whose policy must allow the execution roles
+	// pulling images to decrypt with it.
+	KeyArn pulumi.StringInput
+
+	// CreateKey creates a dedicated key for the repository.
+	CreateKey bool
+
+	// DecryptRoleArns are the roles, i.e. ECS task execution roles, the created
+	// key's policy allows to decrypt images.
+	DecryptRoleArns pulumi.StringArrayInput
+}
+
+func (k *RepositoryKMS) Validate() error {
+	if (k.KeyArn == nil) == !k.CreateKey {
+		return fmt.Errorf("RepositoryKMS must set one of KeyArn or CreateKey")
+	}
+
+	if k.KeyArn != nil && k.DecryptRoleArns != nil {
+		return fmt.Errorf("RepositoryKMS.DecryptRoleArns can only be set with RepositoryKMS.CreateKey")
+	}
+
+	return nil
+}
+
+// decryptWith returns a copy letting the execution role decrypt with a
+// created key unless DecryptRoleArns was set. The caller's config is left as
+// is, so it can be shared between services.
+func (k *RepositoryKMS) decryptWith(executionRoleArn pulumi.StringPtrInput) *RepositoryKMS {
+	if k == nil || !k.CreateKey || k.DecryptRoleArns != nil || executionRoleArn == nil {
+		return k
+	}
+
+	kms := *k
+	kms.DecryptRoleArns = pulumi.StringArray{executionRoleArn.ToStringPtrOutput().Elem()}
+
+	return &kms
+}
+
+// ecrKeyPolicy allows the account to administer the key, ECR to use it for
+// repositories in the region and the roles to decrypt pulled images.
+func ecrKeyPolicy(accountID, region string, decryptRoleArns []string) string {
+	statements := []map[string]interface{}{
+		{
+			"Sid":       "EnableRootPermissions",
+			"Effect":    "Allow",
+			"Principal": map[string]interface{}{"AWS": fmt.Sprintf("arn:aws:iam::%v:root", accountID)},
+			"Action":    "kms:*",
+			"Resource":  "*",
+		},
+		{
+			"Sid":       "AllowECR",
+			"Effect":    "Allow",
+			"Principal": map[string]interface{}{"AWS": "*"},
+			"Action":    []string{"kms:Encrypt", "kms:Decrypt", "kms:ReEncrypt*", "kms:GenerateDataKey*", "kms:DescribeKey", "kms:CreateGrant"},
+			"Resource":  "*",
+			"Condition": map[string]interface{}{
+				"StringEquals": map[string]interface{}{
+					"kms:CallerAccount": accountID,
+					"kms:ViaService":    fmt.Sprintf("ecr.%v.amazonaws.com", region),
+				},
+			},
+		},
+	}
+
+	if len(decryptRoleArns) > 0 {
+		statements = append(statements, map[string]interface{}{
+			"Sid":       "AllowPullDecrypt",
+			"Effect":    "Allow",
+			"Principal": map[string]interface{}{"AWS": decryptRoleArns},
+			"Action":    []string{"kms:Decrypt", "kms:DescribeKey"},
+			"Resource":  "*",
+		})
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"Version":   "2012-10-17",
+		"Statement": statements,
+	})
+
+	return string(data)
+}
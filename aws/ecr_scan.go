@@ -0,0 +1,323 @@
+package aws
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pulumi/pulumi-command/sdk/go/command/local"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// ScanSeverities are the ECR finding severities, from most to least severe.
+// Enhanced scanning reports UNTRIAGED, basic scanning UNDEFINED, for findings
+// without a severity.
+var ScanSeverities = []string{"CRITICAL", "HIGH", "MEDIUM", "LOW", "INFORMATIONAL", "UNTRIAGED", "UNDEFINED"}
+
+// ScanGate waits for the ECR scan of a pushed image and fails the deployment
+// when its findings exceed the allowed counts.
+type ScanGate struct {
+	// MaxFindings is the number of findings allowed per severity. Severities
+	// that aren't listed are not limited. Defaults to no CRITICAL findings.
+	MaxFindings map[string]int
+
+	// Allowlist ignores findings until they expire.
+	Allowlist []AllowedFinding
+
+	// Timeout is how long to wait for the scan to complete. Defaults to 10 minutes.
+	Timeout time.Duration
+}
+
+// AllowedFinding ignores a finding, i.e. a CVE without a fix available yet.
+type AllowedFinding struct {
+	// ID is the finding name, i.e. <CVE-2023-1234>.
+	ID string
+
+	// Expires is the date, as YYYY-MM-DD, after which the finding fails the gate again.
+	Expires string
+
+	Reason string
+}
+
+func (g *ScanGate) Validate() error {
+	if g.MaxFindings == nil {
+		g.MaxFindings = map[string]int{"CRITICAL": 0}
+	}
+
+	for severity, max := range g.MaxFindings {
+		valid := false
+		for _, known := range ScanSeverities {
+			if severity == known {
+				valid = true
+				break
+			}
+		}
+
+		if !valid {
+			return fmt.Errorf("ScanGate.MaxFindings severity <%v> is invalid - must be one of %v", severity, ScanSeverities)
+		}
+
+		if max < 0 {
+			return fmt.Errorf("ScanGate.MaxFindings[%v] cannot be negative", severity)
+		}
+	}
+
+	for idx, allowed := range g.Allowlist {
+		if allowed.ID == "" {
+			return fmt.Errorf("missing ScanGate.Allowlist[%d].ID", idx)
+		}
+
+		if _, err := time.Parse("2006-01-02", allowed.Expires); err != nil {
+			return fmt.Errorf("ScanGate.Allowlist[%d].Expires <%v> is invalid - must be a YYYY-MM-DD date", idx, allowed.Expires)
+		}
+	}
+
+	if g.Timeout == 0 {
+		g.Timeout = 10 * time.Minute
+	}
+
+	return nil
+}
+
+type scanStatus struct {
+	Status      string `json:"status"`
+	Description string `json:"description"`
+}
+
+type scanFinding struct {
+	Name     string `json:"name"`
+	Severity string `json:"severity"`
+}
+
+// enhancedScanFinding is a finding of enhanced scanning with Amazon Inspector.
+type enhancedScanFinding struct {
+	Title                       string `json:"title"`
+	Severity                    string `json:"severity"`
+	PackageVulnerabilityDetails struct {
+		VulnerabilityID string `json:"vulnerabilityId"`
+	} `json:"packageVulnerabilityDetails"`
+}
+
+// scanFindingsResult is the describe-image-scan-findings response. Basic
+// scanning reports findings, enhanced scanning enhancedFindings.
+type scanFindingsResult struct {
+	ImageScanStatus   scanStatus `json:"imageScanStatus"`
+	ImageScanFindings struct {
+		Findings         []scanFinding         `json:"findings"`
+		EnhancedFindings []enhancedScanFinding `json:"enhancedFindings"`
+	} `json:"imageScanFindings"`
+}
+
+// findings returns the basic and enhanced scanning findings, naming enhanced
+// findings by their vulnerability ID.
+func (r *scanFindingsResult) findings() []scanFinding {
+	findings := append([]scanFinding{}, r.ImageScanFindings.Findings...)
+	for _, enhanced := range r.ImageScanFindings.EnhancedFindings {
+		name := enhanced.PackageVulnerabilityDetails.VulnerabilityID
+		if name == "" {
+			name = enhanced.Title
+		}
+
+		findings = append(findings, scanFinding{Name: name, Severity: enhanced.Severity})
+	}
+
+	return findings
+}
+
+// ScanSummary counts an image's findings by severity.
+type ScanSummary struct {
+	Counts map[string]int
+
+	// Allowed are the allowlisted findings that were ignored.
+	Allowed []string
+
+	// Expired are the allowlisted findings whose allowance has expired.
+	Expired []string
+}
+
+func (s *ScanSummary) String() string {
+	counts := []string{}
+	for _, severity := range ScanSeverities {
+		if s.Counts[severity] > 0 {
+			counts = append(counts, fmt.Sprintf("%v=%d", severity, s.Counts[severity]))
+		}
+	}
+
+	if len(counts) == 0 {
+		counts = append(counts, "none")
+	}
+
+	summary := fmt.Sprintf("findings: %v", strings.Join(counts, " "))
+	if len(s.Allowed) > 0 {
+		summary += fmt.Sprintf(", allowlisted: %v", strings.Join(s.Allowed, " "))
+	}
+
+	if len(s.Expired) > 0 {
+		summary += fmt.Sprintf(", expired allowlist: %v", strings.Join(s.Expired, " "))
+	}
+
+	return summary
+}
+
+// evaluate summarizes the completed scan result, returning an error when the
+// findings exceed MaxFindings. Allowlist entries apply through their expiry date.
+// Enhanced scanning reports ACTIVE once the image is scanned continuously.
+func (g *ScanGate) evaluate(result *scanFindingsResult, now time.Time) (*ScanSummary, error) {
+	if status := result.ImageScanStatus.Status; status != "COMPLETE" && status != "ACTIVE" {
+		return nil, fmt.Errorf("image scan is %v: %v", status, result.ImageScanStatus.Description)
+	}
+
+	allowlist := map[string]time.Time{}
+	for _, allowed := range g.Allowlist {
+		expires, _ := time.Parse("2006-01-02", allowed.Expires)
+		allowlist[allowed.ID] = expires.AddDate(0, 0, 1)
+	}
+
+	summary := &ScanSummary{Counts: map[string]int{}}
+	allowed := map[string]bool{}
+	expired := map[string]bool{}
+	for _, finding := range result.findings() {
+		if finding.Severity == "" {
+			return nil, fmt.Errorf("image scan finding %v has no severity", finding.Name)
+		}
+
+		if expires, ok := allowlist[finding.Name]; ok {
+			if now.Before(expires) {
+				allowed[finding.Name] = true
+				continue
+			}
+			expired[finding.Name] = true
+		}
+
+		summary.Counts[finding.Severity]++
+	}
+	summary.Allowed = sortedSet(allowed)
+	summary.Expired = sortedSet(expired)
+
+	exceeded := []string{}
+	for _, severity := range ScanSeverities {
+		max, ok := g.MaxFindings[severity]
+		if ok && summary.Counts[severity] > max {
+			exceeded = append(exceeded, fmt.Sprintf("%d %v (max %d)", summary.Counts[severity], severity, max))
+		}
+	}
+
+	if len(exceeded) > 0 {
+		return summary, fmt.Errorf("image scan found %v", strings.Join(exceeded, ", "))
+	}
+
+	return summary, nil
+}
+
+// scanGateScript waits for the scan of the image to complete, then prints the
+// time it completed followed by the findings.
+const scanGateScript = `set -euo pipefail
+errors=$(mktemp)
+trap 'rm -f "$errors"' EXIT
+
+deadline=$(( $(date +%s) + TIMEOUT_SECONDS ))
+while :; do
+	if status=$(aws ecr describe-image-scan-findings --repository-name "$REPOSITORY" --image-id "imageDigest=$DIGEST" \
+		--query imageScanStatus.status --output text 2>"$errors"); then
+		if [ "$status" != "IN_PROGRESS" ] && [ "$status" != "PENDING" ]; then
+			break
+		fi
+	elif ! grep -q ScanNotFoundException "$errors"; then
+		# The scan isn't registered until shortly after the push.
+		cat "$errors" >&2
+		exit 1
+	fi
+
+	if [ "$(date +%s)" -ge "$deadline" ]; then
+		echo "scan of $REPOSITORY@$DIGEST did not complete within $TIMEOUT_SECONDS seconds" >&2
+		exit 1
+	fi
+	sleep 10
+done
+
+date -u +%Y-%m-%dT%H:%M:%SZ
+aws ecr describe-image-scan-findings --repository-name "$REPOSITORY" --image-id "imageDigest=$DIGEST" --output json
+`
+
+// Run creates a local command that waits for the scan of the image, given as
+// <repo-url>@<digest>, and records its findings. The command only runs when
+// the digest changes, so findings reported later against an unchanged image
+// don't block deploys. The returned image resolves once the recorded findings
+// pass the gate, evaluated as of the scan. Running it requires the AWS CLI and
+// bash where Pulumi runs.
+func (g *ScanGate) Run(ctx *pulumi.Context, name string, image pulumi.StringOutput, opts ...pulumi.ResourceOption) (pulumi.StringOutput, *local.Command, error) {
+	target := image.ApplyT(scanTarget).(pulumi.StringArrayOutput)
+
+	command, err := local.NewCommand(ctx, name, &local.CommandArgs{
+		Create:      pulumi.String(scanGateScript),
+		Interpreter: pulumi.StringArray{pulumi.String("/bin/bash"), pulumi.String("-c")},
+		Environment: awsCLIEnvironment(ctx, pulumi.StringMap{
+			"AWS_REGION":      target.Index(pulumi.Int(0)),
+			"REPOSITORY":      target.Index(pulumi.Int(1)),
+			"DIGEST":          target.Index(pulumi.Int(2)),
+			"TIMEOUT_SECONDS": pulumi.String(strconv.Itoa(int(g.Timeout.Seconds()))),
+		}),
+		Triggers: pulumi.Array{image},
+	}, opts...)
+	if err != nil {
+		return pulumi.StringOutput{}, nil, err
+	}
+
+	gated := pulumi.All(image, command.Stdout).ApplyT(func(args []interface{}) (string, error) {
+		image := args[0].(string)
+		scannedAt, findings, _ := strings.Cut(args[1].(string), "\n")
+
+		now, err := time.Parse(time.RFC3339, strings.TrimSpace(scannedAt))
+		if err != nil {
+			return "", fmt.Errorf("scan of %v has no completion time: %v", image, err)
+		}
+
+		result := &scanFindingsResult{}
+		if err := json.Unmarshal([]byte(findings), result); err != nil {
+			return "", fmt.Errorf("scan of %v has invalid findings: %v", image, err)
+		}
+
+		summary, err := g.evaluate(result, now)
+		if summary != nil {
+			_ = ctx.Log.Info(fmt.Sprintf("scan of %v %v", image, summary), nil)
+		}
+		if err != nil {
+			return "", fmt.Errorf("%v: %v", image, err)
+		}
+
+		return image, nil
+	}).(pulumi.StringOutput)
+
+	return gated, command, nil
+}
+
+// scanTarget splits an image given as <repo-url>@<digest> into the region,
+// repository name and digest of its ECR scan.
+func scanTarget(image string) ([]string, error) {
+	repoURL, digest, ok := strings.Cut(image, "@")
+	if !ok {
+		return nil, fmt.Errorf("image <%v> is not referenced by digest", image)
+	}
+
+	// <account>.dkr.ecr.<region>.amazonaws.com/<name>
+	host, repoName, _ := strings.Cut(repoURL, "/")
+	hostParts := strings.Split(host, ".")
+	if len(hostParts) < 4 {
+		return nil, fmt.Errorf("image <%v> is not in an ECR repository", image)
+	}
+
+	return []string{hostParts[3], repoName, digest}, nil
+}
+
+func sortedSet(set map[string]bool) []string {
+	keys := []string{}
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
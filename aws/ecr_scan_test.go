@@ -0,0 +1,211 @@
+package aws
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	assert "github.com/stretchr/testify/require"
+)
+
+func loadScanFindings(t *testing.T, path string) *scanFindingsResult {
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	result := &scanFindingsResult{}
+	assert.NoError(t, json.Unmarshal(data, result))
+
+	return result
+}
+
+func TestScanGate_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		gate    ScanGate
+		wantErr bool
+	}{
+		{
+			name:    "Test validate defaults to no critical findings",
+			gate:    ScanGate{},
+			wantErr: false,
+		},
+		{
+			name:    "Test validate throws an error on an unknown severity",
+			gate:    ScanGate{MaxFindings: map[string]int{"SEVERE": 0}},
+			wantErr: true,
+		},
+		{
+			name:    "Test validate throws an error on a negative max",
+			gate:    ScanGate{MaxFindings: map[string]int{"HIGH": -1}},
+			wantErr: true,
+		},
+		{
+			name:    "Test validate throws an error on an invalid expiry",
+			gate:    ScanGate{Allowlist: []AllowedFinding{{ID: "CVE-2023-4911", Expires: "next week"}}},
+			wantErr: true,
+		},
+		{
+			name:    "Test validate throws an error on a missing ID",
+			gate:    ScanGate{Allowlist: []AllowedFinding{{Expires: "2024-01-31"}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.gate.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("ScanGate.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	gate := ScanGate{}
+	assert.NoError(t, gate.Validate())
+	assert.Equal(t, map[string]int{"CRITICAL": 0}, gate.MaxFindings)
+	assert.Equal(t, 10*time.Minute, gate.Timeout)
+}
+
+func TestScanGate_Evaluate(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		path        string
+		gate        ScanGate
+		wantCounts  map[string]int
+		wantAllowed []string
+		wantExpired []string
+		wantErr     bool
+	}{
+		{
+			name:       "Test evaluate passes a clean scan",
+			path:       "testdata/scan-findings-clean.json",
+			gate:       ScanGate{},
+			wantCounts: map[string]int{},
+			wantErr:    false,
+		},
+		{
+			name:       "Test evaluate fails on critical findings",
+			path:       "testdata/scan-findings-critical.json",
+			gate:       ScanGate{},
+			wantCounts: map[string]int{"CRITICAL": 2, "HIGH": 1, "MEDIUM": 1},
+			wantErr:    true,
+		},
+		{
+			name:       "Test evaluate passes when findings are within the thresholds",
+			path:       "testdata/scan-findings-critical.json",
+			gate:       ScanGate{MaxFindings: map[string]int{"CRITICAL": 2, "HIGH": 1}},
+			wantCounts: map[string]int{"CRITICAL": 2, "HIGH": 1, "MEDIUM": 1},
+			wantErr:    false,
+		},
+		{
+			name: "Test evaluate ignores allowlisted findings through their expiry date",
+			path: "testdata/scan-findings-critical.json",
+			gate: ScanGate{Allowlist: []AllowedFinding{
+				{ID: "CVE-2023-4911", Expires: "2024-01-15"},
+				{ID: "CVE-2023-38545", Expires: "2024-02-01"},
+			}},
+			wantCounts:  map[string]int{"HIGH": 1, "MEDIUM": 1},
+			wantAllowed: []string{"CVE-2023-38545", "CVE-2023-4911"},
+			wantErr:     false,
+		},
+		{
+			name: "Test evaluate counts findings with an expired allowance",
+			path: "testdata/scan-findings-critical.json",
+			gate: ScanGate{Allowlist: []AllowedFinding{
+				{ID: "CVE-2023-4911", Expires: "2024-01-14"},
+				{ID: "CVE-2023-38545", Expires: "2024-02-01"},
+			}},
+			wantCounts:  map[string]int{"CRITICAL": 1, "HIGH": 1, "MEDIUM": 1},
+			wantAllowed: []string{"CVE-2023-38545"},
+			wantExpired: []string{"CVE-2023-4911"},
+			wantErr:     true,
+		},
+		{
+			name:       "Test evaluate fails on critical enhanced scanning findings",
+			path:       "testdata/scan-findings-enhanced.json",
+			gate:       ScanGate{},
+			wantCounts: map[string]int{"CRITICAL": 1, "HIGH": 1, "UNTRIAGED": 1},
+			wantErr:    true,
+		},
+		{
+			name: "Test evaluate ignores allowlisted enhanced scanning findings by vulnerability ID",
+			path: "testdata/scan-findings-enhanced.json",
+			gate: ScanGate{Allowlist: []AllowedFinding{
+				{ID: "CVE-2023-4911", Expires: "2024-02-01"},
+			}},
+			wantCounts:  map[string]int{"HIGH": 1, "UNTRIAGED": 1},
+			wantAllowed: []string{"CVE-2023-4911"},
+			wantErr:     false,
+		},
+		{
+			name:    "Test evaluate fails on a failed scan",
+			path:    "testdata/scan-findings-failed.json",
+			gate:    ScanGate{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, tt.gate.Validate())
+
+			summary, err := tt.gate.evaluate(loadScanFindings(t, tt.path), now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ScanGate.evaluate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantCounts == nil {
+				assert.Nil(t, summary)
+				return
+			}
+
+			assert.Equal(t, tt.wantCounts, summary.Counts)
+			assert.ElementsMatch(t, tt.wantAllowed, summary.Allowed)
+			assert.ElementsMatch(t, tt.wantExpired, summary.Expired)
+		})
+	}
+}
+
+func TestScanSummary_String(t *testing.T) {
+	summary := &ScanSummary{
+		Counts:  map[string]int{"HIGH": 1, "CRITICAL": 2},
+		Allowed: []string{"CVE-2023-38545"},
+	}
+	assert.Equal(t, "findings: CRITICAL=2 HIGH=1, allowlisted: CVE-2023-38545", summary.String())
+
+	assert.Equal(t, "findings: none", (&ScanSummary{Counts: map[string]int{}}).String())
+}
+
+func TestScanTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		image   string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "Test scanTarget splits an ECR image digest",
+			image: "123456789012.dkr.ecr.us-east-1.amazonaws.com/public-api@sha256:7f5b2640",
+			want:  []string{"us-east-1", "public-api", "sha256:7f5b2640"},
+		},
+		{
+			name:    "Test scanTarget throws an error on a tag",
+			image:   "123456789012.dkr.ecr.us-east-1.amazonaws.com/public-api:latest",
+			wantErr: true,
+		},
+		{
+			name:    "Test scanTarget throws an error on a non-ECR registry",
+			image:   "ghcr.io/l1labs/public-api@sha256:7f5b2640",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := scanTarget(tt.image)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("scanTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
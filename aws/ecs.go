@@ -2,21 +2,122 @@ package aws
 
 import (
 	"fmt"
+	"strings"
 
+	awssdk "github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
 	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/cloudwatch"
 	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ecs"
 	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
 	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/kms"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/servicediscovery"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 )
 
+// ContainerInsights modes for ECS.ContainerInsights.
+const (
+	ContainerInsightsEnabled  = "enabled"
+	ContainerInsightsEnhanced = "enhanced"
+	ContainerInsightsDisabled = "disabled"
+)
+
 type ECS struct {
-	Name          string
+	Name string
+
+	// ContainerInsights is enabled, enhanced or disabled. Defaults to enabled.
+	// Enhanced adds task and container level metrics at a higher cost.
+	ContainerInsights string
+
+	// EnableLogging logs ECS Exec sessions to an encrypted log group.
 	EnableLogging bool
 
+	// ExecLogRetentionDays must be one of LogRetentionDays. Defaults to 365.
+	ExecLogRetentionDays int
+
+	// ExecLogKmsKeyArn encrypts exec sessions and their log group with an
+	// existing key instead of a created one. Its policy must allow CloudWatch
+	// Logs to use it.
+	ExecLogKmsKeyArn pulumi.StringInput
+
+	// ServiceConnectNamespace creates a Cloud Map HTTP namespace with this name
+	// and makes it the cluster's Service Connect default.
+	ServiceConnectNamespace string
+
+	// EC2 adds an Auto Scaling group capacity provider alongside Fargate.
+	EC2 *EC2Capacity
+
+	// ExecutionPermissions extend the task execution role beyond the AWS managed
+	// policy, i.e. reading secrets or private registry credentials. Use
+	// ExtendExecutionRole to add statements after the cluster is run.
+	ExecutionPermissions []Permission
+
+	// CreateTaskRole creates a baseline task role with TaskPermissions that
+	// services can share and extend with ExtendTaskRole.
+	CreateTaskRole  bool
+	TaskPermissions []Permission
+
+	// PermissionsBoundary is the ARN of the policy limiting the execution role,
+	// the baseline task role and the task roles of services run in the cluster.
+	PermissionsBoundary pulumi.StringInput
+
+	// Exports namespaces or disables the cluster's stack exports.
+	Exports *Exports
+
 	Out struct {
-		Cluster      *ecs.Cluster
-		TaskExecRole *iam.Role
+		Cluster           *ecs.Cluster
+		Namespace         *servicediscovery.HttpNamespace
+		ExecLogKey        *kms.Key
+		ExecLogKeyArn     pulumi.StringInput
+		ExecLogGroup      *cloudwatch.LogGroup
+		CapacityProviders *ecs.ClusterCapacityProviders
+		TaskExecRole      *iam.Role
+		TaskRole          *iam.Role
+	}
+}
+
+// ECSOutputs are the cluster values other stacks consume.
+type ECSOutputs struct {
+	// ClusterID is the cluster ARN.
+	ClusterID       pulumi.StringOutput
+	ClusterName     pulumi.StringOutput
+	TaskExecRoleArn pulumi.StringOutput
+
+	// ExecLogGroupID is only exported with EnableLogging, otherwise it is nil.
+	ExecLogGroupID pulumi.StringPtrOutput
+
+	// TaskRoleArn is only exported with CreateTaskRole, otherwise it is nil.
+	TaskRoleArn pulumi.StringPtrOutput
+}
+
+// Outputs returns the cluster's outputs once it has been run.
+func (e *ECS) Outputs() *ECSOutputs {
+	outputs := &ECSOutputs{
+		ClusterID:       e.Out.Cluster.ID().ToStringOutput(),
+		ClusterName:     e.Out.Cluster.Name,
+		TaskExecRoleArn: e.Out.TaskExecRole.Arn,
+		ExecLogGroupID:  noStringPtr(),
+		TaskRoleArn:     noStringPtr(),
+	}
+
+	if e.Out.ExecLogGroup != nil {
+		outputs.ExecLogGroupID = e.Out.ExecLogGroup.ID().ToStringOutput().ToStringPtrOutput()
+	}
+
+	if e.Out.TaskRole != nil {
+		outputs.TaskRoleArn = e.Out.TaskRole.Arn.ToStringPtrOutput()
+	}
+
+	return outputs
+}
+
+// ECSOutputsFromStack reads the outputs of the named cluster from the stack
+// that deployed it, which must have been deployed with the same Exports.
+func ECSOutputsFromStack(ref *pulumi.StackReference, name string, exports *Exports) *ECSOutputs {
+	return &ECSOutputs{
+		ClusterID:       exports.stringOutput(ref, name, "CLUSTER-ID"),
+		ClusterName:     exports.stringOutput(ref, name, "CLUSTER-NAME"),
+		TaskExecRoleArn: exports.stringOutput(ref, name, "TASK-EXEC-ROLE-ARN"),
+		ExecLogGroupID:  exports.stringPtrOutput(ref, name, "CLUSTER-LOG-GROUP-ID"),
+		TaskRoleArn:     exports.stringPtrOutput(ref, name, "TASK-ROLE-ARN"),
 	}
 }
 
@@ -25,61 +126,126 @@ func (e *ECS) Validate() error {
 		return fmt.Errorf("missing ECS.Name")
 	}
 
+	if e.ContainerInsights == "" {
+		e.ContainerInsights = ContainerInsightsEnabled
+	}
+
+	switch e.ContainerInsights {
+	case ContainerInsightsEnabled, ContainerInsightsEnhanced, ContainerInsightsDisabled:
+	default:
+		return fmt.Errorf("ECS.ContainerInsights <%v> is invalid - must be enabled, enhanced or disabled", e.ContainerInsights)
+	}
+
+	if !e.EnableLogging && (e.ExecLogRetentionDays != 0 || e.ExecLogKmsKeyArn != nil) {
+		return fmt.Errorf("ECS.ExecLogRetentionDays and ECS.ExecLogKmsKeyArn require ECS.EnableLogging")
+	}
+
+	if e.EnableLogging {
+		if e.ExecLogRetentionDays == 0 {
+			e.ExecLogRetentionDays = 365
+		}
+
+		if err := (&LogOptions{RetentionDays: e.ExecLogRetentionDays}).Validate(); err != nil {
+			return err
+		}
+	}
+
+	if e.EC2 != nil {
+		// The EC2 capacity provider is named after the cluster, and capacity
+		// provider names cannot start with aws, ecs or fargate.
+		for _, prefix := range []string{"aws", "ecs", "fargate"} {
+			if strings.HasPrefix(strings.ToLower(e.Name), prefix) {
+				return fmt.Errorf("ECS.Name <%v> is invalid - must not start with %v when ECS.EC2 is set", e.Name, prefix)
+			}
+		}
+
+		if err := e.EC2.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := validatePermissions(e.ExecutionPermissions); err != nil {
+		return err
+	}
+
+	if !e.CreateTaskRole && e.TaskPermissions != nil {
+		return fmt.Errorf("ECS.TaskPermissions requires ECS.CreateTaskRole")
+	}
+
 	return nil
 }
 
-func (e *ECS) Run(ctx *pulumi.Context) error {
+func (e *ECS) Run(ctx *pulumi.Context, opts ...pulumi.ResourceOption) error {
 	if err := e.Validate(); err != nil {
 		return err
 	}
-	var cluster *ecs.Cluster
-	if e.EnableLogging {
-		logKey, err := kms.NewKey(ctx, fmt.Sprintf("%v-log-key", e.Name), &kms.KeyArgs{
-			Description:          pulumi.String(fmt.Sprintf("%v KMS encryption key for logging container activity", e.Name)),
-			DeletionWindowInDays: pulumi.Int(7),
-		})
+
+	var serviceConnectDefaults ecs.ClusterServiceConnectDefaultsPtrInput
+	if e.ServiceConnectNamespace != "" {
+		namespace, err := servicediscovery.NewHttpNamespace(ctx, fmt.Sprintf("%v-namespace", e.Name), &servicediscovery.HttpNamespaceArgs{
+			Name:        pulumi.String(e.ServiceConnectNamespace),
+			Description: pulumi.String(fmt.Sprintf("%v Service Connect namespace", e.Name)),
+		}, opts...)
 		if err != nil {
 			return err
 		}
-		ctx.Export("CLUSTER-LOG-KMS-KEY-ID", logKey.ID())
+		e.Out.Namespace = namespace
 
-		logGroup, err := cloudwatch.NewLogGroup(ctx, fmt.Sprintf("%v-log-group", e.Name), nil)
-		if err != nil {
-			return err
+		serviceConnectDefaults = &ecs.ClusterServiceConnectDefaultsArgs{
+			Namespace: namespace.Arn,
 		}
-		ctx.Export("CLUSTER-LOG-GROUP-ID", logGroup.ID())
-
-		cluster, err = ecs.NewCluster(ctx, e.Name, &ecs.ClusterArgs{
-			Configuration: &ecs.ClusterConfigurationArgs{
-				ExecuteCommandConfiguration: &ecs.ClusterConfigurationExecuteCommandConfigurationArgs{
-					KmsKeyId: logKey.Arn,
-					Logging:  pulumi.String("OVERRIDE"),
-					LogConfiguration: &ecs.ClusterConfigurationExecuteCommandConfigurationLogConfigurationArgs{
-						CloudWatchEncryptionEnabled: pulumi.Bool(true),
-						CloudWatchLogGroupName:      logGroup.Name,
-					},
-				},
+	}
+
+	clusterArgs := &ecs.ClusterArgs{
+		ServiceConnectDefaults: serviceConnectDefaults,
+		Settings: ecs.ClusterSettingArray{
+			&ecs.ClusterSettingArgs{
+				Name:  pulumi.String("containerInsights"),
+				Value: pulumi.String(e.ContainerInsights),
 			},
-		})
+		},
+	}
+
+	if e.EnableLogging {
+		configuration, err := e.execLogging(ctx, opts...)
 		if err != nil {
 			return err
 		}
-	} else {
-		var err error
-		cluster, err = ecs.NewCluster(ctx, e.Name, &ecs.ClusterArgs{
-			Settings: ecs.ClusterSettingArray{
-				&ecs.ClusterSettingArgs{
-					Name:  pulumi.String("containerInsights"),
-					Value: pulumi.String("enabled"),
-				},
-			},
-		})
-		if err != nil {
+		clusterArgs.Configuration = configuration
+	}
+
+	cluster, err := ecs.NewCluster(ctx, e.Name, clusterArgs, opts...)
+	if err != nil {
+		return err
+	}
+	e.Out.Cluster = cluster
+	e.Exports.export(ctx, e.Name, "CLUSTER-ID", cluster.ID())
+	e.Exports.export(ctx, e.Name, "CLUSTER-NAME", cluster.Name)
+
+	providers := pulumi.StringArray{pulumi.String(CapacityProviderFargate), pulumi.String(CapacityProviderFargateSpot)}
+	if e.EC2 != nil {
+		if err := e.EC2.Run(ctx, e.Name, cluster, opts...); err != nil {
 			return err
 		}
+		providers = append(providers, e.EC2.Out.CapacityProvider.Name)
 	}
-	e.Out.Cluster = cluster
-	ctx.Export("CLUSTER-ID", cluster.ID())
+
+	// Register Fargate and any EC2 capacity, defaulting services without a
+	// launch type or strategy to on-demand Fargate.
+	capacityProviders, err := ecs.NewClusterCapacityProviders(ctx, fmt.Sprintf("%v-capacity-providers", e.Name), &ecs.ClusterCapacityProvidersArgs{
+		ClusterName:       cluster.Name,
+		CapacityProviders: providers,
+		DefaultCapacityProviderStrategies: ecs.ClusterCapacityProvidersDefaultCapacityProviderStrategyArray{
+			&ecs.ClusterCapacityProvidersDefaultCapacityProviderStrategyArgs{
+				CapacityProvider: pulumi.String(CapacityProviderFargate),
+				Weight:           pulumi.Int(1),
+			},
+		},
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	e.Out.CapacityProviders = capacityProviders
 
 	// Create IAM role that can be used by our service's task.
 	taskExecRole, err := iam.NewRole(ctx, fmt.Sprintf("%v-task-exec-role", e.Name), &iam.RoleArgs{
@@ -95,19 +261,130 @@ func (e *ECS) Run(ctx *pulumi.Context) error {
 					"Action": "sts:AssumeRole"
 				}]
 			}`),
-	})
+		PermissionsBoundary: e.PermissionsBoundary,
+	}, opts...)
 	if err != nil {
 		return err
 	}
 	e.Out.TaskExecRole = taskExecRole
+	e.Exports.export(ctx, e.Name, "TASK-EXEC-ROLE-ARN", taskExecRole.Arn)
 
 	_, err = iam.NewRolePolicyAttachment(ctx, fmt.Sprintf("%v-task-exec-policy", e.Name), &iam.RolePolicyAttachmentArgs{
 		Role:      taskExecRole.Name,
 		PolicyArn: pulumi.String("arn:aws:iam::aws:policy/service-role/AmazonECSTaskExecutionRolePolicy"),
-	})
+	}, opts...)
 	if err != nil {
 		return err
 	}
 
+	// The -baseline-policy suffix can't collide with the -exec-role-policy
+	// ExtendExecutionRole names services' policies with.
+	if err := extendRole(ctx, fmt.Sprintf("%v-exec-role-baseline-policy", e.Name), taskExecRole, e.ExecutionPermissions, opts...); err != nil {
+		return err
+	}
+
+	if e.CreateTaskRole {
+		taskRole, _, err := taskRole(ctx, fmt.Sprintf("%v-baseline", e.Name), e.TaskPermissions, e.PermissionsBoundary, opts...)
+		if err != nil {
+			return err
+		}
+		e.Out.TaskRole = taskRole
+		e.Exports.export(ctx, e.Name, "TASK-ROLE-ARN", taskRole.Arn)
+	}
+
 	return nil
 }
+
+// ExtendExecutionRole attaches the permissions to the cluster's task execution
+// role as an inline policy. The name, i.e. the service needing them, must be
+// unique within the cluster.
+func (e *ECS) ExtendExecutionRole(ctx *pulumi.Context, name string, permissions []Permission, opts ...pulumi.ResourceOption) error {
+	if e.Out.TaskExecRole == nil {
+		return fmt.Errorf("ECS must be run before extending its execution role")
+	}
+
+	return extendRole(ctx, fmt.Sprintf("%v-%v-exec-role-policy", e.Name, name), e.Out.TaskExecRole, permissions, opts...)
+}
+
+// ExtendTaskRole attaches the permissions to the cluster's baseline task role
+// as an inline policy. They are shared by every service using the role, so a
+// service extending it also grants its permissions to all the others.
+func (e *ECS) ExtendTaskRole(ctx *pulumi.Context, name string, permissions []Permission, opts ...pulumi.ResourceOption) error {
+	if e.Out.TaskRole == nil {
+		return fmt.Errorf("ECS must be run with CreateTaskRole before extending its task role")
+	}
+
+	return extendRole(ctx, fmt.Sprintf("%v-%v-task-role-policy", e.Name, name), e.Out.TaskRole, permissions, opts...)
+}
+
+func extendRole(ctx *pulumi.Context, name string, role *iam.Role, permissions []Permission, opts ...pulumi.ResourceOption) error {
+	if len(permissions) == 0 {
+		return nil
+	}
+
+	if err := validatePermissions(permissions); err != nil {
+		return err
+	}
+
+	_, err := iam.NewRolePolicy(ctx, name, &iam.RolePolicyArgs{
+		Role:   role.Name,
+		Policy: PolicyDocument(permissions),
+	}, opts...)
+
+	return err
+}
+
+// execLogging creates the encrypted log group ECS Exec sessions are logged to,
+// along with the key encrypting them unless ExecLogKmsKeyArn is set. The log
+// group keeps its auto-generated <name>-log-group-<suffix> name, which the key
+// policy matches, so existing clusters don't replace it.
+func (e *ECS) execLogging(ctx *pulumi.Context, opts ...pulumi.ResourceOption) (*ecs.ClusterConfigurationArgs, error) {
+	logGroupName := fmt.Sprintf("%v-log-group", e.Name)
+
+	e.Out.ExecLogKeyArn = e.ExecLogKmsKeyArn
+	if e.ExecLogKmsKeyArn == nil {
+		identity, err := awssdk.GetCallerIdentity(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		region, err := awssdk.GetRegion(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		logKey, err := kms.NewKey(ctx, fmt.Sprintf("%v-log-key", e.Name), &kms.KeyArgs{
+			Description:          pulumi.String(fmt.Sprintf("%v KMS encryption key for logging container activity", e.Name)),
+			DeletionWindowInDays: pulumi.Int(7),
+			EnableKeyRotation:    pulumi.Bool(true),
+			Policy:               pulumi.String(logKeyPolicy(identity.AccountId, region.Name, logGroupName+"-*")),
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+		e.Out.ExecLogKey = logKey
+		e.Out.ExecLogKeyArn = logKey.Arn
+		e.Exports.export(ctx, e.Name, "CLUSTER-LOG-KMS-KEY-ID", logKey.ID())
+	}
+
+	logGroup, err := cloudwatch.NewLogGroup(ctx, logGroupName, &cloudwatch.LogGroupArgs{
+		RetentionInDays: pulumi.Int(e.ExecLogRetentionDays),
+		KmsKeyId:        e.Out.ExecLogKeyArn,
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	e.Out.ExecLogGroup = logGroup
+	e.Exports.export(ctx, e.Name, "CLUSTER-LOG-GROUP-ID", logGroup.ID())
+
+	return &ecs.ClusterConfigurationArgs{
+		ExecuteCommandConfiguration: &ecs.ClusterConfigurationExecuteCommandConfigurationArgs{
+			KmsKeyId: e.Out.ExecLogKeyArn,
+			Logging:  pulumi.String("OVERRIDE"),
+			LogConfiguration: &ecs.ClusterConfigurationExecuteCommandConfigurationLogConfigurationArgs{
+				CloudWatchEncryptionEnabled: pulumi.Bool(true),
+				CloudWatchLogGroupName:      logGroup.Name,
+			},
+		},
+	}, nil
+}
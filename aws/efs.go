@@ -0,0 +1,308 @@
+package aws
+
+import (
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ecs"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/efs"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// EFS creates an encrypted file system with a mount target in each private
+// subnet of the VPC and access points for the services that mount it.
+type EFS struct {
+	Name string
+	VPC  *VPC
+
+	// IngressSecurityGroups are allowed NFS access to the mount targets, i.e.
+	// the security groups of the services mounting the file system.
+	IngressSecurityGroups pulumi.StringArrayInput
+
+	AccessPoints []EFSAccessPoint
+
+	// Exports namespaces or disables the file system's stack exports.
+	Exports *Exports
+
+	Out struct {
+		FileSystem    *efs.FileSystem
+		SecurityGroup *ec2.SecurityGroup
+		MountTargets  []*efs.MountTarget
+		AccessPoints  map[string]*efs.AccessPoint
+	}
+}
+
+// EFSOutputs are the file system values other stacks consume.
+type EFSOutputs struct {
+	FileSystemID    pulumi.StringOutput
+	FileSystemArn   pulumi.StringOutput
+	SecurityGroupID pulumi.StringOutput
+
+	// AccessPointIDs are keyed by access point name.
+	AccessPointIDs pulumi.StringMapOutput
+}
+
+// Outputs returns the file system's outputs once it has been run.
+func (e *EFS) Outputs() *EFSOutputs {
+	return &EFSOutputs{
+		FileSystemID:    e.Out.FileSystem.ID().ToStringOutput(),
+		FileSystemArn:   e.Out.FileSystem.Arn,
+		SecurityGroupID: e.Out.SecurityGroup.ID().ToStringOutput(),
+		AccessPointIDs:  accessPointIDs(e.Out.AccessPoints).ToStringMapOutput(),
+	}
+}
+
+// EFSOutputsFromStack reads the outputs of the named file system from the
+// stack that deployed it, which must have been deployed with the same Exports.
+func EFSOutputsFromStack(ref *pulumi.StackReference, name string, exports *Exports) *EFSOutputs {
+	return &EFSOutputs{
+		FileSystemID:    exports.stringOutput(ref, name, "EFS-ID"),
+		FileSystemArn:   exports.stringOutput(ref, name, "EFS-ARN"),
+		SecurityGroupID: exports.stringOutput(ref, name, "EFS-SECURITY-GROUP-ID"),
+		AccessPointIDs:  exports.stringMapOutput(ref, name, "EFS-ACCESS-POINT-IDS"),
+	}
+}
+
+func accessPointIDs(accessPoints map[string]*efs.AccessPoint) pulumi.StringMap {
+	ids := pulumi.StringMap{}
+	for name, accessPoint := range accessPoints {
+		ids[name] = accessPoint.ID().ToStringOutput()
+	}
+
+	return ids
+}
+
+// EFSAccessPoint is an application entry point into the file system. Requests
+// through it are made as the POSIX user and confined to its path.
+type EFSAccessPoint struct {
+	Name string
+	Path string
+	UID  int
+	GID  int
+
+	// Permissions applied when the path is created. Defaults to 0755.
+	Permissions string
+}
+
+func (e *EFS) Validate() error {
+	if e.Name == "" {
+		return fmt.Errorf("missing EFS.Name")
+	}
+
+	if e.VPC == nil {
+		return fmt.Errorf("missing EFS.VPC")
+	}
+
+	if e.VPC.Out.VPC == nil || len(e.VPC.Out.PrivateSubnets) == 0 {
+		return fmt.Errorf("EFS.VPC must be run first")
+	}
+
+	if e.IngressSecurityGroups == nil {
+		return fmt.Errorf("missing EFS.IngressSecurityGroups")
+	}
+
+	names := map[string]bool{}
+	for idx, ap := range e.AccessPoints {
+		if ap.Name == "" {
+			return fmt.Errorf("missing EFS.AccessPoints[%d].Name", idx)
+		}
+
+		if names[ap.Name] {
+			return fmt.Errorf("duplicate EFS access point <%v>", ap.Name)
+		}
+		names[ap.Name] = true
+
+		if ap.Path == "" || ap.Path[0] != '/' {
+			return fmt.Errorf("EFS.AccessPoints[%d].Path <%v> is invalid - must be an absolute path", idx, ap.Path)
+		}
+
+		if ap.Permissions == "" {
+			e.AccessPoints[idx].Permissions = "0755"
+		}
+	}
+
+	return nil
+}
+
+func (e *EFS) Run(ctx *pulumi.Context, opts ...pulumi.ResourceOption) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+
+	fsName := fmt.Sprintf("%v-efs", e.Name)
+	fileSystem, err := efs.NewFileSystem(ctx, fsName, &efs.FileSystemArgs{
+		CreationToken: pulumi.String(fsName),
+		Encrypted:     pulumi.Bool(true),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(fsName),
+		},
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	e.Out.FileSystem = fileSystem
+	e.Exports.export(ctx, e.Name, "EFS-ID", fileSystem.ID())
+	e.Exports.export(ctx, e.Name, "EFS-ARN", fileSystem.Arn)
+
+	// Require TLS for every client of the file system.
+	policy := fileSystem.Arn.ApplyT(func(arn string) string {
+		return fmt.Sprintf(`{
+			"Version": "2012-10-17",
+			"Statement": [{
+				"Sid": "DenyInsecureTransport",
+				"Effect": "Deny",
+				"Principal": {
+					"AWS": "*"
+				},
+				"Action": "*",
+				"Resource": "%v",
+				"Condition": {
+					"Bool": {
+						"aws:SecureTransport": "false"
+					}
+				}
+			}]
+		}`, arn)
+	}).(pulumi.StringOutput)
+
+	_, err = efs.NewFileSystemPolicy(ctx, fmt.Sprintf("%v-efs-policy", e.Name), &efs.FileSystemPolicyArgs{
+		FileSystemId: fileSystem.ID(),
+		Policy:       policy,
+	}, opts...)
+	if err != nil {
+		return err
+	}
+
+	sgName := fmt.Sprintf("%v-efs-sg", e.Name)
+	securityGroup, err := ec2.NewSecurityGroup(ctx, sgName, &ec2.SecurityGroupArgs{
+		VpcId: e.VPC.ID(),
+		Ingress: ec2.SecurityGroupIngressArray{
+			ec2.SecurityGroupIngressArgs{
+				Protocol:       pulumi.String("tcp"),
+				FromPort:       pulumi.Int(2049),
+				ToPort:         pulumi.Int(2049),
+				SecurityGroups: e.IngressSecurityGroups,
+			},
+		},
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(sgName),
+		},
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	e.Out.SecurityGroup = securityGroup
+	e.Exports.export(ctx, e.Name, "EFS-SECURITY-GROUP-ID", securityGroup.ID())
+
+	for idx, subnet := range e.VPC.Out.PrivateSubnets {
+		mountTarget, err := efs.NewMountTarget(ctx, fmt.Sprintf("%v-efs-mount-target-%d", e.Name, idx+1), &efs.MountTargetArgs{
+			FileSystemId:   fileSystem.ID(),
+			SubnetId:       subnet.ID(),
+			SecurityGroups: pulumi.StringArray{securityGroup.ID()},
+		}, opts...)
+		if err != nil {
+			return err
+		}
+		e.Out.MountTargets = append(e.Out.MountTargets, mountTarget)
+	}
+
+	e.Out.AccessPoints = map[string]*efs.AccessPoint{}
+	for _, ap := range e.AccessPoints {
+		apName := fmt.Sprintf("%v-efs-%v", e.Name, ap.Name)
+		accessPoint, err := efs.NewAccessPoint(ctx, apName, &efs.AccessPointArgs{
+			FileSystemId: fileSystem.ID(),
+			PosixUser: &efs.AccessPointPosixUserArgs{
+				Uid: pulumi.Int(ap.UID),
+				Gid: pulumi.Int(ap.GID),
+			},
+			RootDirectory: &efs.AccessPointRootDirectoryArgs{
+				Path: pulumi.String(ap.Path),
+				CreationInfo: &efs.AccessPointRootDirectoryCreationInfoArgs{
+					OwnerUid:    pulumi.Int(ap.UID),
+					OwnerGid:    pulumi.Int(ap.GID),
+					Permissions: pulumi.String(ap.Permissions),
+				},
+			},
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(apName),
+			},
+		}, opts...)
+		if err != nil {
+			return err
+		}
+		e.Out.AccessPoints[ap.Name] = accessPoint
+	}
+	e.Exports.export(ctx, e.Name, "EFS-ACCESS-POINT-IDS", accessPointIDs(e.Out.AccessPoints))
+
+	return nil
+}
+
+// EFSMount mounts an EFS access point into a service's container.
+type EFSMount struct {
+	EFS           *EFS
+	AccessPoint   string
+	ContainerPath string
+	ReadOnly      bool
+}
+
+func (m *EFSMount) Validate() error {
+	if m.EFS == nil {
+		return fmt.Errorf("missing EFSMount.EFS")
+	}
+
+	if m.AccessPoint == "" {
+		return fmt.Errorf("missing EFSMount.AccessPoint")
+	}
+
+	if m.ContainerPath == "" {
+		return fmt.Errorf("missing EFSMount.ContainerPath")
+	}
+
+	return nil
+}
+
+func (m *EFSMount) volumeName() string {
+	return fmt.Sprintf("%v-%v", m.EFS.Name, m.AccessPoint)
+}
+
+// volume returns the task volume for the mount, with transit encryption and
+// IAM authorization enabled. The EFS must have been run.
+func (m *EFSMount) volume() (*ecs.TaskDefinitionVolumeArgs, error) {
+	accessPoint, ok := m.EFS.Out.AccessPoints[m.AccessPoint]
+	if !ok {
+		return nil, fmt.Errorf("EFS <%v> has no access point <%v>", m.EFS.Name, m.AccessPoint)
+	}
+
+	return &ecs.TaskDefinitionVolumeArgs{
+		Name: pulumi.String(m.volumeName()),
+		EfsVolumeConfiguration: &ecs.TaskDefinitionVolumeEfsVolumeConfigurationArgs{
+			FileSystemId:      m.EFS.Out.FileSystem.ID(),
+			TransitEncryption: pulumi.String("ENABLED"),
+			AuthorizationConfig: &ecs.TaskDefinitionVolumeEfsVolumeConfigurationAuthorizationConfigArgs{
+				AccessPointId: accessPoint.ID(),
+				Iam:           pulumi.String("ENABLED"),
+			},
+		},
+	}, nil
+}
+
+func (m *EFSMount) mountPoint() ContainerMountPoint {
+	return ContainerMountPoint{
+		ContainerPath: m.ContainerPath,
+		ReadOnly:      m.ReadOnly,
+		SourceVolume:  m.volumeName(),
+	}
+}
+
+// permission allows the task role to mount the file system through the access point.
+func (m *EFSMount) permission() Permission {
+	actions := []string{"elasticfilesystem:ClientMount"}
+	if !m.ReadOnly {
+		actions = append(actions, "elasticfilesystem:ClientWrite")
+	}
+
+	return Permission{
+		Actions:   actions,
+		Resources: pulumi.StringArray{m.EFS.Out.FileSystem.Arn},
+	}
+}
@@ -0,0 +1,114 @@
+package aws
+
+import (
+	"fmt"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// Exports controls the stack outputs a component exports. Export names are
+// namespaced by the component name, i.e. <main-VPC-ID>, so several components
+// of a kind can be deployed to one stack. A nil Exports uses the defaults.
+type Exports struct {
+	// Disabled exports nothing.
+	Disabled bool
+
+	// Prefix replaces the component name in export names.
+	Prefix string
+
+	// Names renames exports, keyed by their unprefixed name, i.e. <VPC-ID>.
+	// Renamed exports are not prefixed.
+	Names map[string]string
+}
+
+// name returns the export name of the component's key.
+func (e *Exports) name(component, key string) string {
+	if e != nil {
+		if name, ok := e.Names[key]; ok {
+			return name
+		}
+
+		if e.Prefix != "" {
+			component = e.Prefix
+		}
+	}
+
+	return fmt.Sprintf("%v-%v", component, key)
+}
+
+func (e *Exports) export(ctx *pulumi.Context, component, key string, value pulumi.Input) {
+	if e != nil && e.Disabled {
+		return
+	}
+
+	ctx.Export(e.name(component, key), value)
+}
+
+// stringOutput reads the component's key from a stack exporting it with the same Exports.
+func (e *Exports) stringOutput(ref *pulumi.StackReference, component, key string) pulumi.StringOutput {
+	return ref.GetStringOutput(pulumi.String(e.name(component, key)))
+}
+
+// stringArrayOutput reads the component's array key from a stack exporting it with the same Exports.
+func (e *Exports) stringArrayOutput(ref *pulumi.StackReference, component, key string) pulumi.StringArrayOutput {
+	return ref.GetOutput(pulumi.String(e.name(component, key))).ApplyT(func(value interface{}) ([]string, error) {
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("export <%v> is not an array", e.name(component, key))
+		}
+
+		values := []string{}
+		for _, item := range items {
+			str, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("export <%v> is not a string array", e.name(component, key))
+			}
+			values = append(values, str)
+		}
+
+		return values, nil
+	}).(pulumi.StringArrayOutput)
+}
+
+// stringPtrOutput reads the component's optional key from a stack exporting it
+// with the same Exports. It resolves to nil when the key wasn't exported.
+func (e *Exports) stringPtrOutput(ref *pulumi.StackReference, component, key string) pulumi.StringPtrOutput {
+	return ref.GetOutput(pulumi.String(e.name(component, key))).ApplyT(func(value interface{}) (*string, error) {
+		if value == nil {
+			return nil, nil
+		}
+
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("export <%v> is not a string", e.name(component, key))
+		}
+
+		return &str, nil
+	}).(pulumi.StringPtrOutput)
+}
+
+// stringMapOutput reads the component's map key from a stack exporting it with the same Exports.
+func (e *Exports) stringMapOutput(ref *pulumi.StackReference, component, key string) pulumi.StringMapOutput {
+	return ref.GetOutput(pulumi.String(e.name(component, key))).ApplyT(func(value interface{}) (map[string]string, error) {
+		items, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("export <%v> is not a map", e.name(component, key))
+		}
+
+		values := map[string]string{}
+		for name, item := range items {
+			str, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("export <%v> is not a string map", e.name(component, key))
+			}
+			values[name] = str
+		}
+
+		return values, nil
+	}).(pulumi.StringMapOutput)
+}
+
+// noStringPtr is the value of optional outputs that weren't created.
+func noStringPtr() pulumi.StringPtrOutput {
+	return pulumi.StringPtrFromPtr(nil).ToStringPtrOutput()
+}
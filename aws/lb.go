@@ -23,6 +23,9 @@ type LoadBalancer struct {
 	IngressSelf          *bool
 	IngressSecurityGroup *string
 
+	// Exports namespaces or disables the load balancer's stack exports.
+	Exports *Exports
+
 	Out struct {
 		SecurityGroup *ec2.SecurityGroup
 		LB            *lb.LoadBalancer
@@ -31,6 +34,60 @@ type LoadBalancer struct {
 	}
 }
 
+// LoadBalancerOutputs are the load balancer values other stacks consume.
+type LoadBalancerOutputs struct {
+	Arn             pulumi.StringOutput
+	DNSName         pulumi.StringOutput
+	ZoneID          pulumi.StringOutput
+	SecurityGroupID pulumi.StringOutput
+	TargetGroupArn  pulumi.StringOutput
+	ListenerArn     pulumi.StringOutput
+
+	// AccessLogsBucket and AccessLogsPrefix are only exported with a
+	// LogBucket, otherwise they are nil.
+	AccessLogsBucket pulumi.StringPtrOutput
+	AccessLogsPrefix pulumi.StringPtrOutput
+}
+
+// Outputs returns the load balancer's outputs once it has been run.
+func (l *LoadBalancer) Outputs() *LoadBalancerOutputs {
+	outputs := &LoadBalancerOutputs{
+		Arn:              l.Out.LB.Arn,
+		DNSName:          l.Out.LB.DnsName,
+		ZoneID:           l.Out.LB.ZoneId,
+		SecurityGroupID:  l.Out.SecurityGroup.ID().ToStringOutput(),
+		TargetGroupArn:   l.Out.TargetGroup.Arn,
+		ListenerArn:      l.Out.Listener.Arn,
+		AccessLogsBucket: noStringPtr(),
+		AccessLogsPrefix: noStringPtr(),
+	}
+
+	if l.LogBucket != nil {
+		outputs.AccessLogsBucket = l.LogBucket.Bucket.ToStringPtrOutput()
+	}
+
+	if l.LogBucket != nil && l.LogPrefix != nil {
+		outputs.AccessLogsPrefix = l.LogPrefix.ToStringOutput().ToStringPtrOutput()
+	}
+
+	return outputs
+}
+
+// LoadBalancerOutputsFromStack reads the outputs of the named load balancer
+// from the stack that deployed it, which must have been deployed with the same Exports.
+func LoadBalancerOutputsFromStack(ref *pulumi.StackReference, name string, exports *Exports) *LoadBalancerOutputs {
+	return &LoadBalancerOutputs{
+		Arn:              exports.stringOutput(ref, name, "LB-ARN"),
+		DNSName:          exports.stringOutput(ref, name, "LB-DNS-NAME"),
+		ZoneID:           exports.stringOutput(ref, name, "LB-ZONE-ID"),
+		SecurityGroupID:  exports.stringOutput(ref, name, "LB-SECURITY-GROUP-ID"),
+		TargetGroupArn:   exports.stringOutput(ref, name, "TARGET-GROUP-ARN"),
+		ListenerArn:      exports.stringOutput(ref, name, "LISTENER-ARN"),
+		AccessLogsBucket: exports.stringPtrOutput(ref, name, "ACCESS-LOGS-BUCKET"),
+		AccessLogsPrefix: exports.stringPtrOutput(ref, name, "ACCESS-LOGS-PREFIX"),
+	}
+}
+
 func (l *LoadBalancer) Validate() error {
 	if l.Name == "" {
 		return fmt.Errorf("LoadBalancer.Name cannot empty")
@@ -107,12 +164,11 @@ func (l *LoadBalancer) Run(ctx *pulumi.Context) error {
 		return err
 	}
 	l.Out.SecurityGroup = securityGroup
+	l.Exports.export(ctx, l.Name, "LB-SECURITY-GROUP-ID", securityGroup.ID())
 
 	lbName := fmt.Sprintf("%v-lb", l.Name)
 	lbArgs := &lb.LoadBalancerArgs{
-		Subnets: pulumi.StringArray{
-			l.VPC.Out.PublicSubnets[0].ID().ToStringOutput(), l.VPC.Out.PublicSubnets[1].ID().ToStringOutput(),
-		},
+		Subnets:                  subnetIDs(l.VPC.Out.PublicSubnets),
 		Name:                     pulumi.String(lbName),
 		LoadBalancerType:         pulumi.String("application"),
 		IpAddressType:            pulumi.String("ipv4"),
@@ -122,8 +178,10 @@ func (l *LoadBalancer) Run(ctx *pulumi.Context) error {
 	}
 
 	if bucket := l.LogBucket; bucket != nil {
-		ctx.Export("access-logs-bucket", bucket.Bucket)
-		ctx.Export("access-logs-prefix", l.LogPrefix)
+		l.Exports.export(ctx, l.Name, "ACCESS-LOGS-BUCKET", bucket.Bucket)
+		if l.LogPrefix != nil {
+			l.Exports.export(ctx, l.Name, "ACCESS-LOGS-PREFIX", l.LogPrefix)
+		}
 
 		lbArgs.AccessLogs = &lb.LoadBalancerAccessLogsArgs{
 			Enabled: pulumi.Bool(true),
@@ -137,6 +195,9 @@ func (l *LoadBalancer) Run(ctx *pulumi.Context) error {
 		return err
 	}
 	l.Out.LB = frontEndLoadBalancer
+	l.Exports.export(ctx, l.Name, "LB-ARN", frontEndLoadBalancer.Arn)
+	l.Exports.export(ctx, l.Name, "LB-DNS-NAME", frontEndLoadBalancer.DnsName)
+	l.Exports.export(ctx, l.Name, "LB-ZONE-ID", frontEndLoadBalancer.ZoneId)
 
 	tgName := fmt.Sprintf("%v-tg", l.Name)
 	frontEndTargetGroup, err := lb.NewTargetGroup(ctx, tgName, &lb.TargetGroupArgs{
@@ -152,6 +213,7 @@ func (l *LoadBalancer) Run(ctx *pulumi.Context) error {
 		return err
 	}
 	l.Out.TargetGroup = frontEndTargetGroup
+	l.Exports.export(ctx, l.Name, "TARGET-GROUP-ARN", frontEndTargetGroup.Arn)
 
 	listenerName := fmt.Sprintf("%v-listener", l.Name)
 	frontEndListener, err := lb.NewListener(ctx, listenerName, &lb.ListenerArgs{
@@ -171,6 +233,7 @@ func (l *LoadBalancer) Run(ctx *pulumi.Context) error {
 		return err
 	}
 	l.Out.Listener = frontEndListener
+	l.Exports.export(ctx, l.Name, "LISTENER-ARN", frontEndListener.Arn)
 
 	if len(l.HTTPS) > 1 {
 		for i := 1; i < len(l.HTTPS); i++ {
@@ -0,0 +1,240 @@
+package aws
+
+import (
+	"fmt"
+
+	awssdk "github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/cloudwatch"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/kms"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/lambda"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// LogRetentionDays are the retention periods CloudWatch Logs accepts.
+var LogRetentionDays = []int{1, 3, 5, 7, 14, 30, 60, 90, 120, 150, 180, 365, 400, 545, 731, 1096, 1827, 2192, 2557, 2922, 3288, 3653}
+
+// LogOptions configures a service's log group and awslogs driver.
+type LogOptions struct {
+	// RetentionDays must be one of LogRetentionDays, or 0 to never expire events.
+	RetentionDays int
+
+	// KmsKeyArn encrypts the log group with an existing key, whose policy must
+	// allow the CloudWatch Logs service principal to use it.
+	KmsKeyArn pulumi.StringInput
+	// CreateKmsKey creates a dedicated key for the log group.
+	CreateKmsKey bool
+
+	// StreamPrefix defaults to fargate.
+	StreamPrefix string
+
+	// MultilinePattern is the regex that marks the start of a log event.
+	MultilinePattern string
+
+	// NonBlocking buffers logs in memory instead of blocking the container
+	// when the log driver can't keep up. MaxBufferSize defaults to 25m.
+	NonBlocking   bool
+	MaxBufferSize string
+
+	Subscriptions []LogSubscription
+}
+
+// LogSubscription ships a log group's events to a Kinesis stream, Firehose
+// delivery stream or Lambda function.
+type LogSubscription struct {
+	Name           string
+	DestinationArn pulumi.StringInput
+	FilterPattern  string
+
+	// RoleArn lets CloudWatch Logs write to a Kinesis or Firehose destination.
+	RoleArn pulumi.StringInput
+
+	// Lambda allows CloudWatch Logs to invoke the destination function.
+	Lambda bool
+}
+
+func (o *LogOptions) Validate() error {
+	valid := o.RetentionDays == 0
+	for _, days := range LogRetentionDays {
+		if o.RetentionDays == days {
+			valid = true
+			break
+		}
+	}
+
+	if !valid {
+		return fmt.Errorf("log retention <%d> is invalid - must be 0 or one of %v", o.RetentionDays, LogRetentionDays)
+	}
+
+	if o.KmsKeyArn != nil && o.CreateKmsKey {
+		return fmt.Errorf("LogOptions.KmsKeyArn cannot be combined with LogOptions.CreateKmsKey")
+	}
+
+	if o.StreamPrefix == "" {
+		o.StreamPrefix = "fargate"
+	}
+
+	if o.NonBlocking && o.MaxBufferSize == "" {
+		o.MaxBufferSize = "25m"
+	}
+
+	names := map[string]bool{}
+	for idx, sub := range o.Subscriptions {
+		if sub.Name == "" {
+			return fmt.Errorf("missing LogOptions.Subscriptions[%d].Name", idx)
+		}
+
+		if names[sub.Name] {
+			return fmt.Errorf("duplicate log subscription <%v>", sub.Name)
+		}
+		names[sub.Name] = true
+
+		if sub.DestinationArn == nil {
+			return fmt.Errorf("missing LogOptions.Subscriptions[%d].DestinationArn", idx)
+		}
+
+		if sub.Lambda && sub.RoleArn != nil {
+			return fmt.Errorf("LogOptions.Subscriptions[%d].RoleArn cannot be set for a Lambda destination", idx)
+		}
+
+		if !sub.Lambda && sub.RoleArn == nil {
+			return fmt.Errorf("missing LogOptions.Subscriptions[%d].RoleArn for a Kinesis or Firehose destination", idx)
+		}
+	}
+
+	return nil
+}
+
+// ServiceLogConfigurationWithOptions creates the service's log group and
+// returns the awslogs configuration for its containers.
+func ServiceLogConfigurationWithOptions(ctx *pulumi.Context, name, region string, options *LogOptions) (*ContainerLogConfig, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+
+	logGroup := fmt.Sprintf("/fargate/service/%v", name)
+	logGroupArgs := &cloudwatch.LogGroupArgs{
+		Name:            pulumi.String(logGroup),
+		Tags:            pulumi.StringMap{},
+		RetentionInDays: pulumi.Int(options.RetentionDays),
+	}
+
+	if options.KmsKeyArn != nil {
+		logGroupArgs.KmsKeyId = options.KmsKeyArn
+	}
+
+	if options.CreateKmsKey {
+		key, err := logGroupKey(ctx, name, region, logGroup)
+		if err != nil {
+			return nil, err
+		}
+		logGroupArgs.KmsKeyId = key.Arn
+	}
+
+	group, err := cloudwatch.NewLogGroup(ctx, logGroup, logGroupArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sub := range options.Subscriptions {
+		subName := fmt.Sprintf("%v-log-%v", name, sub.Name)
+		subArgs := &cloudwatch.LogSubscriptionFilterArgs{
+			Name:           pulumi.String(subName),
+			LogGroup:       group.Name,
+			FilterPattern:  pulumi.String(sub.FilterPattern),
+			DestinationArn: sub.DestinationArn,
+		}
+
+		var subOpts []pulumi.ResourceOption
+		if sub.Lambda {
+			permission, err := lambda.NewPermission(ctx, fmt.Sprintf("%v-invoke", subName), &lambda.PermissionArgs{
+				Action:    pulumi.String("lambda:InvokeFunction"),
+				Function:  sub.DestinationArn,
+				Principal: pulumi.String(fmt.Sprintf("logs.%v.amazonaws.com", region)),
+				SourceArn: pulumi.Sprintf("%s:*", group.Arn),
+			})
+			if err != nil {
+				return nil, err
+			}
+			subOpts = append(subOpts, pulumi.DependsOn([]pulumi.Resource{permission}))
+		} else {
+			subArgs.RoleArn = sub.RoleArn
+		}
+
+		_, err = cloudwatch.NewLogSubscriptionFilter(ctx, subName, subArgs, subOpts...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	logOptions := map[string]interface{}{
+		"awslogs-group":         logGroup,
+		"awslogs-region":        region,
+		"awslogs-stream-prefix": options.StreamPrefix,
+	}
+
+	if options.MultilinePattern != "" {
+		logOptions["awslogs-multiline-pattern"] = options.MultilinePattern
+	}
+
+	if options.NonBlocking {
+		logOptions["mode"] = "non-blocking"
+		logOptions["max-buffer-size"] = options.MaxBufferSize
+	}
+
+	return &ContainerLogConfig{
+		LogDriver:     "awslogs",
+		SecretOptions: nil,
+		Options:       logOptions,
+	}, nil
+}
+
+// logGroupKey creates a KMS key CloudWatch Logs can use to encrypt the named log group.
+func logGroupKey(ctx *pulumi.Context, name, region, logGroup string) (*kms.Key, error) {
+	identity, err := awssdk.GetCallerIdentity(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return kms.NewKey(ctx, fmt.Sprintf("%v-log-group-key", name), &kms.KeyArgs{
+		Description:          pulumi.String(fmt.Sprintf("%v KMS encryption key for %v", name, logGroup)),
+		DeletionWindowInDays: pulumi.Int(7),
+		EnableKeyRotation:    pulumi.Bool(true),
+		Policy:               pulumi.String(logKeyPolicy(identity.AccountId, region, logGroup)),
+	})
+}
+
+// logKeyPolicy allows the account to administer the key and CloudWatch Logs to
+// use it for the named log group only.
+func logKeyPolicy(accountID, region, logGroup string) string {
+	return fmt.Sprintf(`{
+		"Version": "2012-10-17",
+		"Statement": [{
+			"Sid": "EnableRootPermissions",
+			"Effect": "Allow",
+			"Principal": {
+				"AWS": "arn:aws:iam::%[1]v:root"
+			},
+			"Action": "kms:*",
+			"Resource": "*"
+		}, {
+			"Sid": "AllowCloudWatchLogs",
+			"Effect": "Allow",
+			"Principal": {
+				"Service": "logs.%[2]v.amazonaws.com"
+			},
+			"Action": [
+				"kms:Encrypt*",
+				"kms:Decrypt*",
+				"kms:ReEncrypt*",
+				"kms:GenerateDataKey*",
+				"kms:Describe*"
+			],
+			"Resource": "*",
+			"Condition": {
+				"ArnLike": {
+					"kms:EncryptionContext:aws:logs:arn": "arn:aws:logs:%[2]v:%[1]v:log-group:%[3]v"
+				}
+			}
+		}]
+	}`, accountID, region, logGroup)
+}
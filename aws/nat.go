@@ -0,0 +1,194 @@
+package aws
+
+import (
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ssm"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// NAT modes for VPC.NATMode.
+const (
+	// NATModeSingle routes every private subnet through one NAT gateway.
+	NATModeSingle = "single"
+
+	// NATModePerAZ creates a NAT gateway and private route table per zone, so
+	// losing a zone doesn't cut the others off from the internet.
+	NATModePerAZ = "per-az"
+
+	// NATModeInstance routes through a small EC2 instance instead of a NAT
+	// gateway, which is cheaper but neither highly available nor managed.
+	NATModeInstance = "instance"
+
+	// NATModeNone leaves private subnets without internet access, i.e. when VPC
+	// endpoints cover all egress.
+	NATModeNone = "none"
+)
+
+// natInstanceUserData enables IP forwarding and masquerades traffic leaving
+// the instance's primary interface.
+const natInstanceUserData = `#!/bin/bash
+dnf install -y iptables-services
+systemctl enable --now iptables
+echo "net.ipv4.ip_forward=1" > /etc/sysctl.d/90-nat.conf
+sysctl -p /etc/sysctl.d/90-nat.conf
+iface=$(ip route show default | awk '{print $5}')
+iptables -t nat -A POSTROUTING -o "$iface" -j MASQUERADE
+iptables -F FORWARD
+service iptables save
+`
+
+// natRoutes creates the NAT for the VPC's mode and returns the routes of the
+// private route tables, one per zone with NATModePerAZ and a shared one otherwise.
+func (v *VPC) natRoutes(ctx *pulumi.Context) ([]ec2.RouteTableRouteArray, error) {
+	switch v.NATMode {
+	case NATModeNone:
+		return []ec2.RouteTableRouteArray{{}}, nil
+
+	case NATModeInstance:
+		instance, err := v.natInstance(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return []ec2.RouteTableRouteArray{{
+			&ec2.RouteTableRouteArgs{
+				CidrBlock:          pulumi.String("0.0.0.0/0"),
+				NetworkInterfaceId: instance.PrimaryNetworkInterfaceId,
+			},
+		}}, nil
+
+	case NATModePerAZ:
+		routes := []ec2.RouteTableRouteArray{}
+		for idx, subnet := range v.Out.PublicSubnets {
+			natGateway, err := v.natGateway(ctx, fmt.Sprintf("-%d", idx+1), subnet)
+			if err != nil {
+				return nil, err
+			}
+
+			routes = append(routes, ec2.RouteTableRouteArray{
+				&ec2.RouteTableRouteArgs{
+					CidrBlock:    pulumi.String("0.0.0.0/0"),
+					NatGatewayId: natGateway.ID(),
+				},
+			})
+		}
+
+		return routes, nil
+	}
+
+	natGateway, err := v.natGateway(ctx, "", v.Out.PublicSubnets[0])
+	if err != nil {
+		return nil, err
+	}
+	v.Out.NATGateway = natGateway
+	v.Exports.export(ctx, v.Name, "NAT-GATEWAY-ID", natGateway.ID())
+
+	return []ec2.RouteTableRouteArray{{
+		&ec2.RouteTableRouteArgs{
+			CidrBlock:    pulumi.String("0.0.0.0/0"),
+			NatGatewayId: natGateway.ID(),
+		},
+	}}, nil
+}
+
+// natGateway creates a NAT gateway with an elastic IP in the public subnet.
+func (v *VPC) natGateway(ctx *pulumi.Context, suffix string, subnet *ec2.Subnet) (*ec2.NatGateway, error) {
+	eipName := fmt.Sprintf("%v-nat-gateway-ip%v", v.Name, suffix)
+	elasticIPAllocation, err := ec2.NewEip(ctx, eipName, &ec2.EipArgs{
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(eipName),
+		},
+		Vpc: pulumi.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	natName := fmt.Sprintf("%v-nat-gateway%v", v.Name, suffix)
+	natGateway, err := ec2.NewNatGateway(ctx, natName, &ec2.NatGatewayArgs{
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(natName),
+		},
+		AllocationId: elasticIPAllocation.ID(),
+		SubnetId:     subnet.ID(),
+	}, pulumi.DependsOn([]pulumi.Resource{subnet, elasticIPAllocation}))
+	if err != nil {
+		return nil, err
+	}
+
+	v.Out.NATGateways = append(v.Out.NATGateways, natGateway)
+
+	return natGateway, nil
+}
+
+// natInstance creates a NAT instance in the first public subnet, accepting
+// traffic from the VPC.
+func (v *VPC) natInstance(ctx *pulumi.Context) (*ec2.Instance, error) {
+	ami, err := ssm.LookupParameter(ctx, &ssm.LookupParameterArgs{
+		Name: v.NATInstanceAMIParameter,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sgName := fmt.Sprintf("%v-nat-instance-sg", v.Name)
+	securityGroup, err := ec2.NewSecurityGroup(ctx, sgName, &ec2.SecurityGroupArgs{
+		VpcId: v.ID(),
+		Ingress: ec2.SecurityGroupIngressArray{
+			ec2.SecurityGroupIngressArgs{
+				Protocol:   pulumi.String("-1"),
+				FromPort:   pulumi.Int(0),
+				ToPort:     pulumi.Int(0),
+				CidrBlocks: pulumi.StringArray{pulumi.String(v.CidrBlock)},
+			},
+		},
+		Egress: ec2.SecurityGroupEgressArray{
+			ec2.SecurityGroupEgressArgs{
+				Protocol:   pulumi.String("-1"),
+				FromPort:   pulumi.Int(0),
+				ToPort:     pulumi.Int(0),
+				CidrBlocks: pulumi.StringArray{pulumi.String("0.0.0.0/0")},
+			},
+		},
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(sgName),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	instanceName := fmt.Sprintf("%v-nat-instance", v.Name)
+	instance, err := ec2.NewInstance(ctx, instanceName, &ec2.InstanceArgs{
+		Ami:                      pulumi.String(ami.Value),
+		InstanceType:             pulumi.String(v.NATInstanceType),
+		SubnetId:                 v.Out.PublicSubnets[0].ID(),
+		VpcSecurityGroupIds:      pulumi.StringArray{securityGroup.ID()},
+		AssociatePublicIpAddress: pulumi.Bool(true),
+		SourceDestCheck:          pulumi.Bool(false),
+		UserData:                 pulumi.String(natInstanceUserData),
+		MetadataOptions: &ec2.InstanceMetadataOptionsArgs{
+			HttpTokens: pulumi.String("required"),
+		},
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(instanceName),
+		},
+	}, pulumi.IgnoreChanges([]string{"ami"}))
+	if err != nil {
+		return nil, err
+	}
+	v.Out.NATInstance = instance
+
+	return instance, nil
+}
+
+func natGatewayIDs(natGateways []*ec2.NatGateway) pulumi.StringArray {
+	ids := pulumi.StringArray{}
+	for _, natGateway := range natGateways {
+		ids = append(ids, natGateway.ID().ToStringOutput())
+	}
+
+	return ids
+}
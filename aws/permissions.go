@@ -0,0 +1,243 @@
+package aws
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// Permission allows a set of actions on a set of resource ARNs.
+type Permission struct {
+	Sid       string
+	Actions   []string
+	Resources pulumi.StringArrayInput
+}
+
+// ReadBucket allows reading objects from the S3 bucket with the given ARN.
+func ReadBucket(bucketArn pulumi.StringInput) Permission {
+	return Permission{
+		Actions:   []string{"s3:GetObject", "s3:GetObjectVersion", "s3:ListBucket", "s3:GetBucketLocation"},
+		Resources: pulumi.StringArray{bucketArn, pulumi.Sprintf("%s/*", bucketArn)},
+	}
+}
+
+// ReadWriteBucket allows reading, writing and deleting objects in the S3 bucket with the given ARN.
+func ReadWriteBucket(bucketArn pulumi.StringInput) Permission {
+	return Permission{
+		Actions:   []string{"s3:GetObject", "s3:GetObjectVersion", "s3:PutObject", "s3:DeleteObject", "s3:ListBucket", "s3:GetBucketLocation"},
+		Resources: pulumi.StringArray{bucketArn, pulumi.Sprintf("%s/*", bucketArn)},
+	}
+}
+
+// PublishTopic allows publishing to the SNS topic with the given ARN.
+func PublishTopic(topicArn pulumi.StringInput) Permission {
+	return Permission{
+		Actions:   []string{"sns:Publish"},
+		Resources: pulumi.StringArray{topicArn},
+	}
+}
+
+// ReadTable allows reading items from the DynamoDB table with the given ARN and its indexes.
+func ReadTable(tableArn pulumi.StringInput) Permission {
+	return Permission{
+		Actions: []string{
+			"dynamodb:GetItem", "dynamodb:BatchGetItem", "dynamodb:Query", "dynamodb:Scan",
+			"dynamodb:DescribeTable", "dynamodb:ConditionCheckItem",
+		},
+		Resources: pulumi.StringArray{tableArn, pulumi.Sprintf("%s/index/*", tableArn)},
+	}
+}
+
+// ReadWriteTable allows reading and writing items in the DynamoDB table with the given ARN and its indexes.
+func ReadWriteTable(tableArn pulumi.StringInput) Permission {
+	return Permission{
+		Actions: []string{
+			"dynamodb:GetItem", "dynamodb:BatchGetItem", "dynamodb:Query", "dynamodb:Scan",
+			"dynamodb:DescribeTable", "dynamodb:ConditionCheckItem",
+			"dynamodb:PutItem", "dynamodb:UpdateItem", "dynamodb:DeleteItem", "dynamodb:BatchWriteItem",
+		},
+		Resources: pulumi.StringArray{tableArn, pulumi.Sprintf("%s/index/*", tableArn)},
+	}
+}
+
+// ConsumeQueue allows receiving and deleting messages from the SQS queue with the given ARN.
+func ConsumeQueue(queueArn pulumi.StringInput) Permission {
+	return Permission{
+		Actions: []string{
+			"sqs:ReceiveMessage", "sqs:DeleteMessage", "sqs:ChangeMessageVisibility",
+			"sqs:GetQueueAttributes", "sqs:GetQueueUrl",
+		},
+		Resources: pulumi.StringArray{queueArn},
+	}
+}
+
+// UseKMSKey allows encrypting and decrypting with the KMS key with the given ARN.
+func UseKMSKey(keyArn pulumi.StringInput) Permission {
+	return Permission{
+		Actions:   []string{"kms:Decrypt", "kms:Encrypt", "kms:GenerateDataKey", "kms:DescribeKey"},
+		Resources: pulumi.StringArray{keyArn},
+	}
+}
+
+// ReadSecret allows reading the Secrets Manager secret with the given ARN.
+func ReadSecret(secretArn pulumi.StringInput) Permission {
+	return Permission{
+		Actions:   []string{"secretsmanager:GetSecretValue", "secretsmanager:DescribeSecret"},
+		Resources: pulumi.StringArray{secretArn},
+	}
+}
+
+// ExecPermissions allows the task to open ECS Exec sessions and, when the
+// cluster logs exec sessions, write them to its encrypted log group.
+func ExecPermissions(cluster *ECS) []Permission {
+	permissions := []Permission{
+		{
+			Actions: []string{
+				"ssmmessages:CreateControlChannel", "ssmmessages:CreateDataChannel",
+				"ssmmessages:OpenControlChannel", "ssmmessages:OpenDataChannel",
+			},
+			Resources: pulumi.StringArray{pulumi.String("*")},
+		},
+	}
+
+	if cluster == nil || cluster.Out.ExecLogGroup == nil {
+		return permissions
+	}
+
+	return append(permissions,
+		Permission{
+			Actions:   []string{"kms:Decrypt"},
+			Resources: pulumi.StringArray{cluster.Out.ExecLogKeyArn},
+		},
+		Permission{
+			Actions:   []string{"logs:DescribeLogGroups"},
+			Resources: pulumi.StringArray{pulumi.String("*")},
+		},
+		Permission{
+			Actions:   []string{"logs:CreateLogStream", "logs:DescribeLogStreams", "logs:PutLogEvents"},
+			Resources: pulumi.StringArray{pulumi.Sprintf("%s:*", cluster.Out.ExecLogGroup.Arn)},
+		},
+	)
+}
+
+// roleName returns the name of the role with the given ARN, which role
+// policies reference it by.
+func roleName(roleArn pulumi.StringPtrInput) pulumi.StringOutput {
+	return roleArn.ToStringPtrOutput().Elem().ApplyT(func(arn string) string {
+		return arn[strings.LastIndex(arn, "/")+1:]
+	}).(pulumi.StringOutput)
+}
+
+type policyDocument struct {
+	Version   string            `json:"Version"`
+	Statement []policyStatement `json:"Statement"`
+}
+
+type policyStatement struct {
+	Sid      string   `json:"Sid,omitempty"`
+	Effect   string   `json:"Effect"`
+	Action   []string `json:"Action"`
+	Resource []string `json:"Resource"`
+}
+
+// PolicyDocument renders the permissions as an IAM policy document.
+func PolicyDocument(permissions []Permission) pulumi.StringOutput {
+	resources := make([]interface{}, len(permissions))
+	for idx, permission := range permissions {
+		resources[idx] = permission.Resources
+	}
+
+	return pulumi.All(resources...).ApplyT(func(args []interface{}) (string, error) {
+		doc := policyDocument{
+			Version:   "2012-10-17",
+			Statement: []policyStatement{},
+		}
+
+		for idx, permission := range permissions {
+			arns, ok := args[idx].([]string)
+			if !ok {
+				return "", fmt.Errorf("failed to coerce resources for permission %d", idx)
+			}
+
+			doc.Statement = append(doc.Statement, policyStatement{
+				Sid:      permission.Sid,
+				Effect:   "Allow",
+				Action:   permission.Actions,
+				Resource: arns,
+			})
+		}
+
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return "", err
+		}
+
+		return string(data), nil
+	}).(pulumi.StringOutput)
+}
+
+// TaskRole creates a role assumable by ECS tasks with an inline policy scoped
+// to the given permissions, returning the role and the policy document.
+func TaskRole(ctx *pulumi.Context, name string, permissions []Permission, opts ...pulumi.ResourceOption) (*iam.Role, pulumi.StringOutput, error) {
+	return taskRole(ctx, name, permissions, nil, opts...)
+}
+
+// taskRole creates the task role, limited by the permissions boundary policy when set.
+func taskRole(ctx *pulumi.Context, name string, permissions []Permission, permissionsBoundary pulumi.StringInput, opts ...pulumi.ResourceOption) (*iam.Role, pulumi.StringOutput, error) {
+	if err := validatePermissions(permissions); err != nil {
+		return nil, pulumi.StringOutput{}, err
+	}
+
+	roleName := fmt.Sprintf("%v-task-role", name)
+	role, err := iam.NewRole(ctx, roleName, &iam.RoleArgs{
+		AssumeRolePolicy: pulumi.String(
+			`{
+				"Version": "2008-10-17",
+				"Statement": [{
+					"Sid": "",
+					"Effect": "Allow",
+					"Principal": {
+						"Service": "ecs-tasks.amazonaws.com"
+					},
+					"Action": "sts:AssumeRole"
+				}]
+			}`),
+		PermissionsBoundary: permissionsBoundary,
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(roleName),
+		},
+	}, opts...)
+	if err != nil {
+		return nil, pulumi.StringOutput{}, err
+	}
+
+	policy := PolicyDocument(permissions)
+	if len(permissions) > 0 {
+		_, err = iam.NewRolePolicy(ctx, fmt.Sprintf("%v-task-policy", name), &iam.RolePolicyArgs{
+			Role:   role.Name,
+			Policy: policy,
+		}, opts...)
+		if err != nil {
+			return nil, pulumi.StringOutput{}, err
+		}
+	}
+
+	return role, policy, nil
+}
+
+func validatePermissions(permissions []Permission) error {
+	for idx, permission := range permissions {
+		if len(permission.Actions) == 0 {
+			return fmt.Errorf("missing Permission.Actions for permission %d", idx)
+		}
+
+		if permission.Resources == nil {
+			return fmt.Errorf("missing Permission.Resources for permission %d", idx)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,207 @@
+package aws
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ecs"
+	"github.com/pulumi/pulumi-command/sdk/go/command/local"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// PreDeployTask is a one-off Fargate task run with the service's image before
+// the service is updated, i.e. database migrations. The task runs whenever its
+// task definition changes, i.e. on a new image, so the command it runs must be
+// idempotent. Running it requires the AWS CLI and bash where Pulumi runs.
+type PreDeployTask struct {
+	// Command overrides the image's default command.
+	Command []string
+
+	// Subnets, SecurityGroups and AssignPublicIp default to the service's
+	// network configuration when it is given as *ecs.ServiceNetworkConfigurationArgs.
+	// AssignPublicIp otherwise defaults to false.
+	Subnets        pulumi.StringArrayInput
+	SecurityGroups pulumi.StringArrayInput
+	AssignPublicIp pulumi.BoolInput
+
+	// Timeout is how long to wait for the task to stop. Defaults to 30 minutes.
+	Timeout time.Duration
+
+	Out struct {
+		Task    *ecs.TaskDefinition
+		Command *local.Command
+	}
+}
+
+// Validate the pre-deploy task configuration, filling network defaults from the service.
+func (p *PreDeployTask) Validate(service *ecs.ServiceArgs) error {
+	if len(p.Command) == 0 {
+		return fmt.Errorf("missing PreDeployTask.Command")
+	}
+
+	if service.Cluster == nil {
+		return fmt.Errorf("Service.Service.Cluster is required to run a PreDeployTask")
+	}
+
+	if network, ok := service.NetworkConfiguration.(*ecs.ServiceNetworkConfigurationArgs); ok && network != nil {
+		if p.Subnets == nil {
+			p.Subnets = network.Subnets
+		}
+
+		if p.SecurityGroups == nil {
+			p.SecurityGroups = network.SecurityGroups
+		}
+
+		if p.AssignPublicIp == nil && network.AssignPublicIp != nil {
+			p.AssignPublicIp = network.AssignPublicIp.ToBoolPtrOutput().Elem()
+		}
+	}
+
+	if p.Subnets == nil {
+		return fmt.Errorf("missing PreDeployTask.Subnets")
+	}
+
+	if p.SecurityGroups == nil {
+		p.SecurityGroups = pulumi.StringArray{}
+	}
+
+	if p.AssignPublicIp == nil {
+		p.AssignPublicIp = pulumi.Bool(false)
+	}
+
+	if p.Timeout == 0 {
+		p.Timeout = 30 * time.Minute
+	}
+
+	return nil
+}
+
+// preDeployScript starts the task with the service's launch type or capacity
+// provider strategy, PLACEMENT, and polls it until it stops, failing unless the
+// container exited with code 0 before the deadline.
+const preDeployScript = `set -euo pipefail
+# PLACEMENT is split into its arguments.
+task=$(aws ecs run-task --cluster "$CLUSTER" --task-definition "$TASK_DEFINITION" \
+	$PLACEMENT --network-configuration "$NETWORK_CONFIGURATION" \
+	--query 'tasks[0].taskArn' --output text)
+if [ -z "$task" ] || [ "$task" = "None" ]; then
+	echo "failed to start task $TASK_DEFINITION" >&2
+	exit 1
+fi
+
+echo "waiting for pre-deploy task $task"
+deadline=$(( $(date +%s) + TIMEOUT_SECONDS ))
+while [ "$(date +%s)" -lt "$deadline" ]; do
+	sleep 10
+	status=$(aws ecs describe-tasks --cluster "$CLUSTER" --tasks "$task" --query 'tasks[0].lastStatus' --output text)
+	if [ "$status" != "STOPPED" ]; then
+		continue
+	fi
+
+	code=$(aws ecs describe-tasks --cluster "$CLUSTER" --tasks "$task" \
+		--query "tasks[0].containers[?name=='$CONTAINER'] | [0].exitCode" --output text)
+	if [ "$code" = "0" ]; then
+		exit 0
+	fi
+
+	reason=$(aws ecs describe-tasks --cluster "$CLUSTER" --tasks "$task" --query 'tasks[0].stoppedReason' --output text)
+	echo "pre-deploy task $task exited with code $code: $reason" >&2
+	exit 1
+done
+
+echo "pre-deploy task $task did not stop within $TIMEOUT_SECONDS seconds" >&2
+exit 1
+`
+
+// Run creates a local command that starts the task with the AWS CLI and
+// waits for it to exit successfully. The task is placed like the service,
+// with its launch type or capacity provider strategy, falling back to the
+// cluster's default strategy. The command only runs when the task definition
+// is replaced, never during previews, and uses the AWS provider's region and
+// credentials. Resources that must wait for the task depend on it.
+func (p *PreDeployTask) Run(ctx *pulumi.Context, name, region, container string, service *ecs.ServiceArgs, task *ecs.TaskDefinition, opts ...pulumi.ResourceOption) (*local.Command, error) {
+	network := pulumi.All(p.Subnets, p.SecurityGroups, p.AssignPublicIp).ApplyT(func(args []interface{}) string {
+		assignPublicIp := "DISABLED"
+		if args[2].(bool) {
+			assignPublicIp = "ENABLED"
+		}
+
+		return fmt.Sprintf("awsvpcConfiguration={subnets=[%v],securityGroups=[%v],assignPublicIp=%v}",
+			strings.Join(args[0].([]string), ","), strings.Join(args[1].([]string), ","), assignPublicIp)
+	}).(pulumi.StringOutput)
+
+	env := awsCLIEnvironment(ctx, pulumi.StringMap{
+		"AWS_REGION":            pulumi.String(region),
+		"CLUSTER":               service.Cluster.ToStringPtrOutput().Elem(),
+		"PLACEMENT":             taskPlacement(service),
+		"TASK_DEFINITION":       task.Arn,
+		"CONTAINER":             pulumi.String(container),
+		"NETWORK_CONFIGURATION": network,
+		"TIMEOUT_SECONDS":       pulumi.String(strconv.Itoa(int(p.Timeout.Seconds()))),
+	})
+
+	command, err := local.NewCommand(ctx, fmt.Sprintf("%v-predeploy", name), &local.CommandArgs{
+		Create:      pulumi.String(preDeployScript),
+		Interpreter: pulumi.StringArray{pulumi.String("/bin/bash"), pulumi.String("-c")},
+		Environment: env,
+		Triggers:    pulumi.Array{task.Arn},
+	}, append(opts, pulumi.DependsOn([]pulumi.Resource{task}))...)
+	if err != nil {
+		return nil, err
+	}
+	p.Out.Command = command
+
+	return command, nil
+}
+
+// taskPlacement renders the run-task arguments placing a task like the
+// service, empty when the service uses the cluster's default strategy.
+func taskPlacement(service *ecs.ServiceArgs) pulumi.StringOutput {
+	if service.CapacityProviderStrategies != nil {
+		return service.CapacityProviderStrategies.ToServiceCapacityProviderStrategyArrayOutput().ApplyT(func(strategies []ecs.ServiceCapacityProviderStrategy) string {
+			if len(strategies) == 0 {
+				return ""
+			}
+
+			args := []string{"--capacity-provider-strategy"}
+			for _, strategy := range strategies {
+				arg := fmt.Sprintf("capacityProvider=%v", strategy.CapacityProvider)
+				if strategy.Weight != nil {
+					arg += fmt.Sprintf(",weight=%d", *strategy.Weight)
+				}
+				if strategy.Base != nil {
+					arg += fmt.Sprintf(",base=%d", *strategy.Base)
+				}
+				args = append(args, arg)
+			}
+
+			return strings.Join(args, " ")
+		}).(pulumi.StringOutput)
+	}
+
+	if service.LaunchType != nil {
+		return pulumi.Sprintf("--launch-type %s", service.LaunchType.ToStringPtrOutput().Elem())
+	}
+
+	return pulumi.String("").ToStringOutput()
+}
+
+// awsCLIEnvironment adds the AWS provider's profile or static credentials to
+// the environment of a command running the AWS CLI, so it acts with the same
+// credentials as the provider.
+func awsCLIEnvironment(ctx *pulumi.Context, env pulumi.StringMap) pulumi.StringMap {
+	for key, variable := range map[string]string{
+		"aws:profile":   "AWS_PROFILE",
+		"aws:accessKey": "AWS_ACCESS_KEY_ID",
+		"aws:secretKey": "AWS_SECRET_ACCESS_KEY",
+		"aws:token":     "AWS_SESSION_TOKEN",
+	} {
+		if value, ok := ctx.GetConfig(key); ok && value != "" {
+			env[variable] = pulumi.ToSecret(pulumi.String(value)).(pulumi.StringOutput)
+		}
+	}
+
+	return env
+}
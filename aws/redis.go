@@ -10,15 +10,52 @@ import (
 
 // Redis contains everything needed to spin up a secure Redis instance.
 type Redis struct {
-	Name   string
+	Name string
+	Args *elasticache.ClusterArgs
+
+	// VPC places the cache in the VPC's private subnets.
+	VPC *VPC
+
+	// Deprecated: use VPC.
 	Subnet *ec2.Subnet
-	Args   *elasticache.ClusterArgs
+
+	// Exports namespaces or disables the cache's stack exports.
+	Exports *Exports
 
 	Out struct {
 		Cache *elasticache.Cluster
 	}
 }
 
+// RedisOutputs are the cache values other stacks consume.
+type RedisOutputs struct {
+	Arn pulumi.StringOutput
+
+	// Address is the address of the cache's first node.
+	Address pulumi.StringOutput
+}
+
+// Outputs returns the cache's outputs once it has been run.
+func (r *Redis) Outputs() *RedisOutputs {
+	return &RedisOutputs{
+		Arn:     r.Out.Cache.Arn,
+		Address: redisAddress(r.Out.Cache),
+	}
+}
+
+// RedisOutputsFromStack reads the outputs of the named cache from the stack
+// that deployed it, which must have been deployed with the same Exports.
+func RedisOutputsFromStack(ref *pulumi.StackReference, name string, exports *Exports) *RedisOutputs {
+	return &RedisOutputs{
+		Arn:     exports.stringOutput(ref, name, "REDIS-ARN"),
+		Address: exports.stringOutput(ref, name, "REDIS-ADDRESS"),
+	}
+}
+
+func redisAddress(cache *elasticache.Cluster) pulumi.StringOutput {
+	return cache.CacheNodes.Index(pulumi.Int(0)).Address().Elem()
+}
+
 func (r *Redis) Validate() error {
 	if r.Name == "" {
 		return fmt.Errorf("Redis.Name cannot empty")
@@ -28,8 +65,8 @@ func (r *Redis) Validate() error {
 		return fmt.Errorf("Redis.Args cannot be nil")
 	}
 
-	if r.Subnet == nil {
-		return fmt.Errorf("Redis.Subnet cannot empty")
+	if (r.VPC == nil) == (r.Subnet == nil) {
+		return fmt.Errorf("Redis must set one of VPC or Subnet")
 	}
 
 	return nil
@@ -40,13 +77,16 @@ func (r *Redis) Run(ctx *pulumi.Context) error {
 		return err
 	}
 
+	subnets := []*ec2.Subnet{r.Subnet}
+	if r.VPC != nil {
+		subnets = r.VPC.Out.PrivateSubnets
+	}
+
 	redisSubnetName := fmt.Sprintf("%v-subnet", r.Name)
 	redisSubnet, err := elasticache.NewSubnetGroup(ctx, redisSubnetName, &elasticache.SubnetGroupArgs{
-		Name: pulumi.String(redisSubnetName),
-		SubnetIds: pulumi.StringArray{
-			r.Subnet.ID(),
-		},
-	}, pulumi.DependsOn([]pulumi.Resource{r.Subnet}))
+		Name:      pulumi.String(redisSubnetName),
+		SubnetIds: subnetIDs(subnets),
+	}, pulumi.DependsOn(subnetResources(subnets)))
 	if err != nil {
 		return err
 	}
@@ -71,6 +111,8 @@ func (r *Redis) Run(ctx *pulumi.Context) error {
 	}
 
 	r.Out.Cache = cache
+	r.Exports.export(ctx, r.Name, "REDIS-ARN", cache.Arn)
+	r.Exports.export(ctx, r.Name, "REDIS-ADDRESS", redisAddress(cache))
 
 	return nil
 }
@@ -0,0 +1,168 @@
+package aws
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v5/go/aws/ecr"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/secretsmanager"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// Registry is where an image is pushed to when it isn't a repository created
+// by Docker. Use ExistingECR, GHCR, DockerHub or GenericRegistry.
+type Registry struct {
+	// ECRRepository is the name of an existing ECR repository. It isn't managed,
+	// so ECS pulls from it with the execution role's ECR permissions.
+	ECRRepository string
+
+	// Server is the host of a non-ECR registry, i.e. <ghcr.io>.
+	Server string
+
+	// Repository is the image repository on the server, i.e. <my-org/my-app>.
+	Repository string
+
+	// Username and Password push the image, i.e. from secret config values.
+	Username pulumi.StringInput
+	Password pulumi.StringInput
+
+	// CredentialsSecretArn is an existing Secrets Manager secret, with username
+	// and password keys, ECS pulls the image with. Defaults to a secret created
+	// from Username and Password.
+	CredentialsSecretArn pulumi.StringInput
+}
+
+// ExistingECR pushes to an existing ECR repository with the given name.
+func ExistingECR(name string) *Registry {
+	return &Registry{ECRRepository: name}
+}
+
+// GHCR pushes to the GitHub Container Registry, i.e. <my-org/my-app>, with a
+// personal access token allowed to write packages.
+func GHCR(repository string, username, token pulumi.StringInput) *Registry {
+	return GenericRegistry("ghcr.io", repository, username, token)
+}
+
+// DockerHub pushes to Docker Hub, i.e. <my-org/my-app>, with an access token.
+func DockerHub(repository string, username, token pulumi.StringInput) *Registry {
+	return GenericRegistry("docker.io", repository, username, token)
+}
+
+// GenericRegistry pushes to the repository on any registry server.
+func GenericRegistry(server, repository string, username, password pulumi.StringInput) *Registry {
+	return &Registry{
+		Server:     server,
+		Repository: repository,
+		Username:   username,
+		Password:   password,
+	}
+}
+
+func (r *Registry) Validate() error {
+	if r.isECR() {
+		if r.Server != "" || r.Repository != "" || r.Username != nil || r.Password != nil || r.CredentialsSecretArn != nil {
+			return fmt.Errorf("Registry.ECRRepository cannot be combined with a registry server or credentials")
+		}
+
+		return nil
+	}
+
+	if r.Server == "" {
+		return fmt.Errorf("missing Registry.Server or Registry.ECRRepository")
+	}
+
+	if r.Repository == "" {
+		return fmt.Errorf("missing Registry.Repository")
+	}
+
+	if r.Username == nil || r.Password == nil {
+		return fmt.Errorf("missing Registry.Username and Registry.Password for <%v>", r.Server)
+	}
+
+	return nil
+}
+
+// needsExecutionRole reports whether ECS pulls from the registry with
+// credentials the task execution role must be allowed to read.
+func (r *Registry) needsExecutionRole() bool {
+	return r != nil && !r.isECR()
+}
+
+func (r *Registry) isECR() bool {
+	return r.ECRRepository != ""
+}
+
+// repoName is the name of the ECR repository images are pushed to.
+func (d *Docker) repoName() string {
+	if d.Registry != nil && d.Registry.isECR() {
+		return d.Registry.ECRRepository
+	}
+
+	return d.Name
+}
+
+// registry returns the repository URL and push credentials, creating the ECR
+// repository or, for a non-ECR registry, the pull credentials secret.
+func (d *Docker) registry(ctx *pulumi.Context, opts ...pulumi.ResourceOption) (pulumi.StringInput, pulumi.StringInput, pulumi.StringInput, error) {
+	if d.Registry == nil {
+		repo, err := d.ecrRepository(ctx, opts...)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		d.Out.Repo = repo
+
+		user, pass := ecrCredentials(ctx, repo.RegistryId)
+
+		return repo.RepositoryUrl, user, pass, nil
+	}
+
+	if d.Registry.isECR() {
+		repo, err := ecr.LookupRepository(ctx, &ecr.LookupRepositoryArgs{
+			Name: d.Registry.ECRRepository,
+		})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		user, pass := ecrCredentials(ctx, pulumi.String(repo.RegistryId))
+
+		return pulumi.String(repo.RepositoryUrl), user, pass, nil
+	}
+
+	d.Out.RepositoryCredentials = d.Registry.CredentialsSecretArn
+	if d.Out.RepositoryCredentials == nil {
+		secretName := fmt.Sprintf("%v-registry-credentials", d.Name)
+		// A prefixed name lets a replacement be created while the deleted
+		// secret is still pending deletion.
+		secret, err := secretsmanager.NewSecret(ctx, secretName, &secretsmanager.SecretArgs{
+			NamePrefix:  pulumi.String(fmt.Sprintf("%v-", secretName)),
+			Description: pulumi.String(fmt.Sprintf("%v credentials for %v", d.Name, d.Registry.Server)),
+		}, opts...)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		credentials := pulumi.All(d.Registry.Username, d.Registry.Password).ApplyT(func(args []interface{}) (string, error) {
+			data, err := json.Marshal(map[string]string{
+				"username": args[0].(string),
+				"password": args[1].(string),
+			})
+
+			return string(data), err
+		}).(pulumi.StringOutput)
+
+		_, err = secretsmanager.NewSecretVersion(ctx, secretName, &secretsmanager.SecretVersionArgs{
+			SecretId:     secret.ID(),
+			SecretString: pulumi.ToSecret(credentials).(pulumi.StringOutput),
+		}, opts...)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		d.Out.RepositoryCredentials = secret.Arn
+	}
+
+	repoURL := fmt.Sprintf("%v/%v", d.Registry.Server, d.Registry.Repository)
+
+	return pulumi.String(repoURL), d.Registry.Username, d.Registry.Password, nil
+}
@@ -0,0 +1,361 @@
+package aws
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/cloudwatch"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ecs"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/sqs"
+	"github.com/pulumi/pulumi-docker/sdk/v4/go/docker"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// ScheduledTask runs an ECS task on a cron or rate schedule through EventBridge.
+type ScheduledTask struct {
+	Name   string
+	Region string
+
+	// Cluster is the ARN of the ECS cluster the task runs in.
+	Cluster pulumi.StringInput
+
+	// Schedule is an EventBridge schedule expression, i.e. <cron(0 12 * * ? *)> or <rate(5 minutes)>.
+	Schedule string
+
+	Docker *docker.DockerBuildArgs
+	Task   *ecs.TaskDefinitionArgs
+
+	// Image configures the image repository, i.e. its lifecycle and policy.
+	// Name defaults to the task's and Docker is always the task's.
+	Image *Docker
+
+	// Command overrides the image's default command.
+	Command []string
+
+	TaskCount      int
+	Subnets        pulumi.StringArrayInput
+	SecurityGroups pulumi.StringArrayInput
+	AssignPublicIp bool
+
+	LinuxParameters *ContainerLinuxParameters
+	MountPoints     []ContainerMountPoint
+
+	SidecarContainers pulumi.StringArrayInput
+
+	Env          pulumi.StringMapInput
+	Secrets      pulumi.StringMapInput
+	DockerLabels pulumi.StringMapInput
+
+	// Specifies the number of days
+	// you want to retain log events in the specified log group, 0 never expiring them.
+	LogRetentionDays int
+
+	// Logs configures the log group and log driver. Cannot be combined with LogRetentionDays.
+	Logs *LogOptions
+
+	// DeadLetter creates an SQS queue that receives events EventBridge failed to deliver.
+	DeadLetter bool
+
+	// RetryPolicy controls how failed invocations are retried.
+	RetryPolicy *cloudwatch.EventTargetRetryPolicyArgs
+
+	// Exports namespaces or disables the scheduled task's stack exports.
+	Exports *Exports
+
+	// logs are Logs, or the options LogRetentionDays stands for.
+	logs *LogOptions
+
+	Out struct {
+		Task            *ecs.TaskDefinition
+		Rule            *cloudwatch.EventRule
+		Target          *cloudwatch.EventTarget
+		EventRole       *iam.Role
+		DeadLetterQueue *sqs.Queue
+	}
+}
+
+// ScheduledTaskOutputs are the scheduled task values other stacks consume.
+type ScheduledTaskOutputs struct {
+	TaskDefinitionArn pulumi.StringOutput
+	RuleArn           pulumi.StringOutput
+
+	// DeadLetterQueueArn is only exported with DeadLetter, otherwise it is nil.
+	DeadLetterQueueArn pulumi.StringPtrOutput
+}
+
+// Outputs returns the scheduled task's outputs once it has been run.
+func (t *ScheduledTask) Outputs() *ScheduledTaskOutputs {
+	outputs := &ScheduledTaskOutputs{
+		TaskDefinitionArn:  t.Out.Task.Arn,
+		RuleArn:            t.Out.Rule.Arn,
+		DeadLetterQueueArn: noStringPtr(),
+	}
+
+	if t.Out.DeadLetterQueue != nil {
+		outputs.DeadLetterQueueArn = t.Out.DeadLetterQueue.Arn.ToStringPtrOutput()
+	}
+
+	return outputs
+}
+
+// ScheduledTaskOutputsFromStack reads the outputs of the named scheduled task
+// from the stack that deployed it, which must have been deployed with the same Exports.
+func ScheduledTaskOutputsFromStack(ref *pulumi.StackReference, name string, exports *Exports) *ScheduledTaskOutputs {
+	return &ScheduledTaskOutputs{
+		TaskDefinitionArn:  exports.stringOutput(ref, name, "SCHEDULED-TASK-DEFINITION-ARN"),
+		RuleArn:            exports.stringOutput(ref, name, "SCHEDULED-TASK-RULE-ARN"),
+		DeadLetterQueueArn: exports.stringPtrOutput(ref, name, "SCHEDULED-TASK-DEAD-LETTER-QUEUE-ARN"),
+	}
+}
+
+// Validate the scheduled task configuration.
+func (t *ScheduledTask) Validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("missing ScheduledTask.Name")
+	}
+
+	if t.Region == "" {
+		return fmt.Errorf("missing ScheduledTask.Region")
+	}
+
+	if t.Cluster == nil {
+		return fmt.Errorf("missing ScheduledTask.Cluster")
+	}
+
+	if !strings.HasPrefix(t.Schedule, "cron(") && !strings.HasPrefix(t.Schedule, "rate(") || !strings.HasSuffix(t.Schedule, ")") {
+		return fmt.Errorf("ScheduledTask.Schedule <%v> is invalid - must be a cron(...) or rate(...) expression", t.Schedule)
+	}
+
+	if t.Docker == nil {
+		return fmt.Errorf("missing ScheduledTask.Docker args")
+	}
+
+	if t.Task == nil {
+		return fmt.Errorf("missing ScheduledTask.Task args")
+	}
+
+	if t.Task.ContainerDefinitions != nil {
+		return fmt.Errorf("ScheduledTask.Task.ContainerDefinitions conflicts with the generated container definitions")
+	}
+
+	if t.Image != nil && t.Image.Registry.needsExecutionRole() && t.Task.ExecutionRoleArn == nil {
+		return fmt.Errorf("ScheduledTask.Task.ExecutionRoleArn is required to pull from <%v>", t.Image.Registry.Server)
+	}
+
+	if t.Subnets == nil {
+		return fmt.Errorf("missing ScheduledTask.Subnets")
+	}
+
+	if t.Logs != nil && t.LogRetentionDays != 0 {
+		return fmt.Errorf("ScheduledTask.LogRetentionDays cannot be combined with ScheduledTask.Logs")
+	}
+
+	t.logs = t.Logs
+	if t.logs == nil {
+		t.logs = &LogOptions{RetentionDays: t.LogRetentionDays}
+	}
+
+	if err := t.logs.Validate(); err != nil {
+		return err
+	}
+
+	if t.TaskCount < 0 {
+		return fmt.Errorf("ScheduledTask.TaskCount cannot be negative")
+	}
+
+	if t.TaskCount == 0 {
+		t.TaskCount = 1
+	}
+
+	return nil
+}
+
+// Run will create the task definition, schedule and target, returning any errors.
+func (t *ScheduledTask) Run(ctx *pulumi.Context, opts ...pulumi.ResourceOption) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+
+	d := t.Image
+	if d == nil {
+		d = &Docker{}
+	}
+
+	if d.Name == "" {
+		d.Name = t.Name
+	}
+	d.Docker = t.Docker
+
+	d.KMS = d.KMS.decryptWith(t.Task.ExecutionRoleArn)
+
+	if err := d.Run(ctx, opts...); err != nil {
+		return err
+	}
+
+	if err := imagePullPolicy(ctx, t.Name, t.Task.ExecutionRoleArn, d, opts...); err != nil {
+		return err
+	}
+
+	// Create log group
+	logConfiguration, err := ServiceLogConfigurationWithOptions(ctx, t.Name, t.Region, t.logs)
+	if err != nil {
+		return err
+	}
+
+	// Create container definition
+	containerDef := containerDefinitions(ContainerDefinition{
+		Name:             t.Name,
+		Command:          t.Command,
+		LinuxParameters:  t.LinuxParameters,
+		MountPoints:      t.MountPoints,
+		LogConfiguration: logConfiguration,
+	}, d.Out.ImageName, d.Out.RepositoryCredentials, t.Env, t.Secrets, t.DockerLabels, t.SidecarContainers)
+
+	taskName := fmt.Sprintf("%v-task", t.Name)
+	var family pulumi.StringInput = pulumi.String(taskName)
+	if t.Task.Family != nil {
+		family = t.Task.Family
+	}
+
+	if t.Task.NetworkMode == nil {
+		t.Task.NetworkMode = pulumi.String("awsvpc")
+	}
+
+	if t.Task.RequiresCompatibilities == nil {
+		t.Task.RequiresCompatibilities = pulumi.StringArray{pulumi.String("FARGATE")}
+	}
+
+	task, err := ecs.NewTaskDefinition(ctx, taskName, taskDefinitionArgs(t.Task, family, taskName, containerDef), opts...)
+	if err != nil {
+		return err
+	}
+	t.Out.Task = task
+	t.Exports.export(ctx, t.Name, "SCHEDULED-TASK-DEFINITION-ARN", task.Arn)
+
+	// Create IAM role that EventBridge assumes to run the task.
+	eventRole, err := iam.NewRole(ctx, fmt.Sprintf("%v-event-role", t.Name), &iam.RoleArgs{
+		AssumeRolePolicy: pulumi.String(
+			`{
+				"Version": "2012-10-17",
+				"Statement": [{
+					"Sid": "",
+					"Effect": "Allow",
+					"Principal": {
+						"Service": "events.amazonaws.com"
+					},
+					"Action": "sts:AssumeRole"
+				}]
+			}`),
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	t.Out.EventRole = eventRole
+
+	_, err = iam.NewRolePolicyAttachment(ctx, fmt.Sprintf("%v-event-policy", t.Name), &iam.RolePolicyAttachmentArgs{
+		Role:      eventRole.Name,
+		PolicyArn: pulumi.String("arn:aws:iam::aws:policy/service-role/AmazonEC2ContainerServiceEventsRole"),
+	}, opts...)
+	if err != nil {
+		return err
+	}
+
+	ruleName := fmt.Sprintf("%v-schedule", t.Name)
+	rule, err := cloudwatch.NewEventRule(ctx, ruleName, &cloudwatch.EventRuleArgs{
+		Name:               pulumi.String(ruleName),
+		ScheduleExpression: pulumi.String(t.Schedule),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(ruleName),
+		},
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	t.Out.Rule = rule
+	t.Exports.export(ctx, t.Name, "SCHEDULED-TASK-RULE-ARN", rule.Arn)
+
+	targetArgs := &cloudwatch.EventTargetArgs{
+		Rule:    rule.Name,
+		Arn:     t.Cluster,
+		RoleArn: eventRole.Arn,
+		EcsTarget: &cloudwatch.EventTargetEcsTargetArgs{
+			TaskDefinitionArn: task.Arn,
+			TaskCount:         pulumi.Int(t.TaskCount),
+			LaunchType:        pulumi.String("FARGATE"),
+			NetworkConfiguration: &cloudwatch.EventTargetEcsTargetNetworkConfigurationArgs{
+				Subnets:        t.Subnets,
+				SecurityGroups: t.SecurityGroups,
+				AssignPublicIp: pulumi.Bool(t.AssignPublicIp),
+			},
+		},
+		RetryPolicy: t.RetryPolicy,
+	}
+
+	if t.DeadLetter {
+		dlq, err := t.deadLetterQueue(ctx, rule, opts...)
+		if err != nil {
+			return err
+		}
+
+		targetArgs.DeadLetterConfig = &cloudwatch.EventTargetDeadLetterConfigArgs{
+			Arn: dlq.Arn,
+		}
+		t.Exports.export(ctx, t.Name, "SCHEDULED-TASK-DEAD-LETTER-QUEUE-ARN", dlq.Arn)
+	}
+
+	target, err := cloudwatch.NewEventTarget(ctx, fmt.Sprintf("%v-target", t.Name), targetArgs, opts...)
+	if err != nil {
+		return err
+	}
+	t.Out.Target = target
+
+	return nil
+}
+
+// deadLetterQueue creates the SQS queue failed invocations are sent to, along
+// with a queue policy allowing the schedule rule to deliver to it.
+func (t *ScheduledTask) deadLetterQueue(ctx *pulumi.Context, rule *cloudwatch.EventRule, opts ...pulumi.ResourceOption) (*sqs.Queue, error) {
+	dlqName := fmt.Sprintf("%v-dlq", t.Name)
+	dlq, err := sqs.NewQueue(ctx, dlqName, &sqs.QueueArgs{
+		Name:                    pulumi.String(dlqName),
+		MessageRetentionSeconds: pulumi.Int(1209600),
+		SqsManagedSseEnabled:    pulumi.Bool(true),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(dlqName),
+		},
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	t.Out.DeadLetterQueue = dlq
+
+	policy := pulumi.All(dlq.Arn, rule.Arn).ApplyT(func(args []interface{}) string {
+		return fmt.Sprintf(`{
+			"Version": "2012-10-17",
+			"Statement": [{
+				"Effect": "Allow",
+				"Principal": {
+					"Service": "events.amazonaws.com"
+				},
+				"Action": "sqs:SendMessage",
+				"Resource": "%v",
+				"Condition": {
+					"ArnEquals": {
+						"aws:SourceArn": "%v"
+					}
+				}
+			}]
+		}`, args[0], args[1])
+	}).(pulumi.StringOutput)
+
+	_, err = sqs.NewQueuePolicy(ctx, fmt.Sprintf("%v-dlq-policy", t.Name), &sqs.QueuePolicyArgs{
+		QueueUrl: dlq.Url,
+		Policy:   policy,
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return dlq, nil
+}
@@ -2,10 +2,11 @@ package aws
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
-	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/cloudwatch"
 	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ecs"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
 	"github.com/pulumi/pulumi-docker/sdk/v4/go/docker"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 )
@@ -19,6 +20,36 @@ type Service struct {
 	Task    *ecs.TaskDefinitionArgs
 	Service *ecs.ServiceArgs
 
+	// Image configures the image repository, i.e. its lifecycle and policy.
+	// Name defaults to the service's and Docker is always the service's.
+	Image *Docker
+
+	// ECS is the cluster the service runs in. When set it defaults
+	// Service.Cluster and Task.ExecutionRoleArn, applies the cluster's
+	// permissions boundary to the task role and lets EnableExec follow the
+	// cluster's exec logging.
+	ECS *ECS
+
+	// UseClusterTaskRole runs the service with the ECS baseline task role,
+	// extending it with the service's Permissions. Requires ECS.CreateTaskRole.
+	// The role is shared, so every service using it is granted the
+	// Permissions, EFS mount and exec permissions of all the others. Use a
+	// dedicated task role for permissions one service alone should hold.
+	UseClusterTaskRole bool
+
+	// EnableExec turns on ECS Exec for the service and grants the task role the
+	// permissions it needs, including the cluster's exec logging when ECS is set.
+	EnableExec bool
+
+	// Architecture is the CPU architecture tasks run on and the image is built
+	// for, X86_64 or ARM64. Cannot be combined with Task.RuntimePlatform, whose
+	// CpuArchitecture picks the build platform instead. Defaults to X86_64.
+	Architecture string
+
+	// MultiArch builds the image for both X86_64 and ARM64 behind a single
+	// multi-architecture manifest.
+	MultiArch bool
+
 	Ports           []ContainerPortMapping
 	LinuxParameters *ContainerLinuxParameters
 	MountPoints     []ContainerMountPoint
@@ -28,16 +59,119 @@ type Service struct {
 	Env          pulumi.StringMapInput
 	DockerLabels pulumi.StringMapInput
 
+	// Secrets maps environment variable names to the Secrets Manager or SSM
+	// parameter ARNs they are read from.
+	Secrets pulumi.StringMapInput
+
 	// Specifies the number of days
-	// you want to retain log events in the specified log group.  Possible values are: 1, 3, 5, 7, 14, 30, 60, 90, 120, 150, 180, 365, 400, 545, 731, 1827, and 3653.
+	// you want to retain log events in the specified log group.  Possible values are 0 to never expire them or one of LogRetentionDays.
 	LogRetentionDays int
 
+	// Logs configures the log group and log driver. Cannot be combined with LogRetentionDays.
+	Logs *LogOptions
+
+	// ServiceConnect enables ECS Service Connect for the service.
+	ServiceConnect *ServiceConnect
+
+	// Capacity places the service's tasks on a mix of Fargate and Fargate Spot.
+	// Cannot be combined with Service.LaunchType or Service.CapacityProviderStrategies.
+	Capacity *CapacityStrategy
+
+	// EFSMounts mounts EFS access points into the container. When
+	// Task.TaskRoleArn is not set the mount permissions are added to the
+	// generated task role, otherwise the caller's role must allow them.
+	EFSMounts []EFSMount
+
+	// Permissions generates a dedicated task role with an inline policy scoped
+	// to the given resources, or extends the shared cluster task role when
+	// UseClusterTaskRole is set. Cannot be combined with Task.TaskRoleArn.
+	Permissions []Permission
+
+	// PreDeploy runs a one-off task with the service's image before the
+	// service is updated. A failing task fails the deployment.
+	PreDeploy *PreDeployTask
+
+	// Exports namespaces or disables the service's stack exports.
+	Exports *Exports
+
+	// autoscaled leaves the desired count to Application Auto Scaling once the
+	// service is created, so deployments don't reset it.
+	autoscaled bool
+
+	// logs are Logs, or the options LogRetentionDays stands for.
+	logs *LogOptions
+
 	Out struct {
 		Task    *ecs.TaskDefinition
 		Service *ecs.Service
+
+		TaskRole *iam.Role
+		// TaskPolicy is the generated task role policy document, for review.
+		TaskPolicy pulumi.StringOutput
 	}
 }
 
+// ServiceOutputs are the service values other stacks consume.
+type ServiceOutputs struct {
+	// ServiceID is the service ARN.
+	ServiceID         pulumi.StringOutput
+	ServiceName       pulumi.StringOutput
+	TaskDefinitionArn pulumi.StringOutput
+
+	// TaskRoleArn is only exported when the service runs with a generated or
+	// the cluster's task role, otherwise it is nil.
+	TaskRoleArn pulumi.StringPtrOutput
+}
+
+// Outputs returns the service's outputs once it has been run.
+func (s *Service) Outputs() *ServiceOutputs {
+	outputs := &ServiceOutputs{
+		ServiceID:         s.Out.Service.ID().ToStringOutput(),
+		ServiceName:       s.Out.Service.Name,
+		TaskDefinitionArn: s.Out.Task.Arn,
+		TaskRoleArn:       noStringPtr(),
+	}
+
+	if s.Out.TaskRole != nil {
+		outputs.TaskRoleArn = s.Out.TaskRole.Arn.ToStringPtrOutput()
+	}
+
+	return outputs
+}
+
+// ServiceOutputsFromStack reads the outputs of the named service from the
+// stack that deployed it, which must have been deployed with the same Exports.
+func ServiceOutputsFromStack(ref *pulumi.StackReference, name string, exports *Exports) *ServiceOutputs {
+	return &ServiceOutputs{
+		ServiceID:         exports.stringOutput(ref, name, "SERVICE-ID"),
+		ServiceName:       exports.stringOutput(ref, name, "SERVICE-NAME"),
+		TaskDefinitionArn: exports.stringOutput(ref, name, "SERVICE-TASK-DEFINITION-ARN"),
+		TaskRoleArn:       exports.stringPtrOutput(ref, name, "SERVICE-TASK-ROLE-ARN"),
+	}
+}
+
+// architecturePlatforms maps ECS CPU architectures to Docker build platforms.
+var architecturePlatforms = map[string]string{
+	"X86_64": "linux/amd64",
+	"ARM64":  "linux/arm64",
+}
+
+// architecture is the CPU architecture the image is built for, Architecture or
+// the CpuArchitecture of the task's RuntimePlatform.
+func (s *Service) architecture() string {
+	if s.Architecture != "" {
+		return s.Architecture
+	}
+
+	if platform, ok := s.Task.RuntimePlatform.(*ecs.TaskDefinitionRuntimePlatformArgs); ok && platform != nil {
+		if arch, ok := platform.CpuArchitecture.(pulumi.String); ok {
+			return string(arch)
+		}
+	}
+
+	return ""
+}
+
 // Validate the service configuration.
 func (s *Service) Validate() error {
 	if s.Name == "" {
@@ -60,6 +194,127 @@ func (s *Service) Validate() error {
 		return fmt.Errorf("missing Service.Service args")
 	}
 
+	if s.Logs != nil && s.LogRetentionDays != 0 {
+		return fmt.Errorf("Service.LogRetentionDays cannot be combined with Service.Logs")
+	}
+
+	s.logs = s.Logs
+	if s.logs == nil {
+		s.logs = &LogOptions{RetentionDays: s.LogRetentionDays}
+	}
+
+	if err := s.logs.Validate(); err != nil {
+		return err
+	}
+
+	if s.Task.ContainerDefinitions != nil {
+		return fmt.Errorf("Service.Task.ContainerDefinitions conflicts with the generated container definitions")
+	}
+
+	if tags, ok := s.Task.Tags.(pulumi.StringMap); ok && tags["Name"] != nil {
+		return fmt.Errorf("Service.Task.Tags Name conflicts with the generated Name tag")
+	}
+
+	if s.Permissions != nil && s.Task.TaskRoleArn != nil {
+		return fmt.Errorf("Service.Permissions cannot be combined with Service.Task.TaskRoleArn")
+	}
+
+	if s.ECS != nil {
+		if s.ECS.Out.Cluster == nil {
+			return fmt.Errorf("Service.ECS must be run before the service")
+		}
+
+		if s.Service.Cluster == nil {
+			s.Service.Cluster = s.ECS.Out.Cluster.Arn
+		}
+
+		if s.Task.ExecutionRoleArn == nil {
+			s.Task.ExecutionRoleArn = s.ECS.Out.TaskExecRole.Arn
+		}
+	}
+
+	if s.UseClusterTaskRole {
+		if s.ECS == nil || s.ECS.Out.TaskRole == nil {
+			return fmt.Errorf("Service.UseClusterTaskRole requires Service.ECS run with CreateTaskRole")
+		}
+
+		if s.Task.TaskRoleArn != nil {
+			return fmt.Errorf("Service.UseClusterTaskRole cannot be combined with Service.Task.TaskRoleArn")
+		}
+	}
+
+	if s.Image != nil && s.Image.Registry.needsExecutionRole() && s.Task.ExecutionRoleArn == nil {
+		return fmt.Errorf("Service.Task.ExecutionRoleArn is required to pull from <%v>", s.Image.Registry.Server)
+	}
+
+	if s.ServiceConnect != nil {
+		if err := s.ServiceConnect.Validate(s.Ports); err != nil {
+			return err
+		}
+
+		if s.ServiceConnect.Namespace == nil && (s.ECS == nil || s.ECS.ServiceConnectNamespace == "") {
+			return fmt.Errorf("missing Service.ServiceConnect.Namespace - Service.ECS has no ServiceConnectNamespace default")
+		}
+	}
+
+	if s.Architecture != "" {
+		if _, ok := architecturePlatforms[s.Architecture]; !ok {
+			return fmt.Errorf("Service.Architecture <%v> is invalid - must be X86_64 or ARM64", s.Architecture)
+		}
+
+		if s.Task.RuntimePlatform != nil {
+			return fmt.Errorf("Service.Architecture cannot be combined with Service.Task.RuntimePlatform")
+		}
+	} else if s.Task.RuntimePlatform != nil && !s.MultiArch {
+		platform, ok := s.Task.RuntimePlatform.(*ecs.TaskDefinitionRuntimePlatformArgs)
+		if !ok {
+			return fmt.Errorf("Service.Task.RuntimePlatform must be *ecs.TaskDefinitionRuntimePlatformArgs to pick the build platform")
+		}
+
+		if platform != nil && platform.CpuArchitecture != nil {
+			arch, ok := platform.CpuArchitecture.(pulumi.String)
+			if !ok {
+				return fmt.Errorf("Service.Task.RuntimePlatform.CpuArchitecture must be a pulumi.String to pick the build platform")
+			}
+
+			if _, ok := architecturePlatforms[string(arch)]; !ok {
+				return fmt.Errorf("Service.Task.RuntimePlatform.CpuArchitecture <%v> is invalid - must be X86_64 or ARM64", arch)
+			}
+		}
+	}
+
+	if s.Capacity != nil {
+		if err := s.Capacity.Validate(); err != nil {
+			return err
+		}
+
+		if s.Service.CapacityProviderStrategies != nil {
+			return fmt.Errorf("Service.Capacity cannot be combined with Service.Service.CapacityProviderStrategies")
+		}
+	}
+
+	if s.Service.LaunchType != nil && (s.Capacity != nil || s.Service.CapacityProviderStrategies != nil) {
+		return fmt.Errorf("Service.Service.LaunchType cannot be combined with a capacity provider strategy")
+	}
+
+	for idx := range s.EFSMounts {
+		if err := s.EFSMounts[idx].Validate(); err != nil {
+			return err
+		}
+	}
+
+	if len(s.EFSMounts) > 0 {
+		if _, ok := s.Task.Volumes.(ecs.TaskDefinitionVolumeArray); s.Task.Volumes != nil && !ok {
+			return fmt.Errorf("Service.Task.Volumes must be an ecs.TaskDefinitionVolumeArray to add EFSMounts")
+		}
+	}
+
+	if s.PreDeploy != nil {
+		if err := s.PreDeploy.Validate(s.Service); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -69,31 +324,252 @@ func (s *Service) Run(ctx *pulumi.Context, opts ...pulumi.ResourceOption) error
 		return err
 	}
 
-	d := &Docker{
-		Name:   s.Name,
-		Docker: s.Docker,
+	d := s.Image
+	if d == nil {
+		d = &Docker{}
 	}
 
+	if d.Name == "" {
+		d.Name = s.Name
+	}
+	d.Docker = s.Docker
+
+	if s.MultiArch {
+		d.Platforms = []string{architecturePlatforms["X86_64"], architecturePlatforms["ARM64"]}
+	} else if arch := s.architecture(); arch != "" {
+		d.Platforms = []string{architecturePlatforms[arch]}
+	}
+
+	if s.Architecture != "" {
+		s.Task.RuntimePlatform = &ecs.TaskDefinitionRuntimePlatformArgs{
+			CpuArchitecture:       pulumi.String(s.Architecture),
+			OperatingSystemFamily: pulumi.String("LINUX"),
+		}
+	}
+
+	d.KMS = d.KMS.decryptWith(s.Task.ExecutionRoleArn)
+
 	if err := d.Run(ctx, opts...); err != nil {
 		return err
 	}
 
+	if err := imagePullPolicy(ctx, s.Name, s.Task.ExecutionRoleArn, d, opts...); err != nil {
+		return err
+	}
+
 	// Create log group
-	logConfiguration, err := ServiceLogConfiguration(ctx, s.Name, s.Region, s.LogRetentionDays)
+	logConfiguration, err := ServiceLogConfigurationWithOptions(ctx, s.Name, s.Region, s.logs)
 	if err != nil {
 		return err
 	}
 
-	if s.Env == nil {
-		s.Env = pulumi.StringMap{}
+	if len(s.EFSMounts) > 0 {
+		volumes, _ := s.Task.Volumes.(ecs.TaskDefinitionVolumeArray)
+		for idx := range s.EFSMounts {
+			mount := &s.EFSMounts[idx]
+			volume, err := mount.volume()
+			if err != nil {
+				return err
+			}
+
+			volumes = append(volumes, volume)
+			s.MountPoints = append(s.MountPoints, mount.mountPoint())
+
+			if s.Task.TaskRoleArn == nil {
+				s.Permissions = append(s.Permissions, mount.permission())
+			}
+		}
+		s.Task.Volumes = volumes
+	}
+
+	if s.EnableExec {
+		s.Service.EnableExecuteCommand = pulumi.Bool(true)
+
+		if s.Task.TaskRoleArn == nil {
+			s.Permissions = append(s.Permissions, ExecPermissions(s.ECS)...)
+		} else {
+			// Extend the caller's role, which is referenced by name in role policies.
+			_, err := iam.NewRolePolicy(ctx, fmt.Sprintf("%v-exec-policy", s.Name), &iam.RolePolicyArgs{
+				Role:   roleName(s.Task.TaskRoleArn),
+				Policy: PolicyDocument(ExecPermissions(s.ECS)),
+			}, opts...)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
-	if s.SidecarContainers == nil {
-		s.SidecarContainers = pulumi.StringArray{}
+	if s.UseClusterTaskRole {
+		if err := s.ECS.ExtendTaskRole(ctx, s.Name, s.Permissions, opts...); err != nil {
+			return err
+		}
+		s.Out.TaskRole = s.ECS.Out.TaskRole
+		s.Out.TaskPolicy = PolicyDocument(s.Permissions)
+		s.Task.TaskRoleArn = s.ECS.Out.TaskRole.Arn
+	} else if s.Permissions != nil {
+		var permissionsBoundary pulumi.StringInput
+		if s.ECS != nil {
+			permissionsBoundary = s.ECS.PermissionsBoundary
+		}
+
+		taskRole, taskPolicy, err := taskRole(ctx, s.Name, s.Permissions, permissionsBoundary, opts...)
+		if err != nil {
+			return err
+		}
+		s.Out.TaskRole = taskRole
+		s.Out.TaskPolicy = taskPolicy
+		s.Task.TaskRoleArn = taskRole.Arn
 	}
 
 	// Create container definition
-	containerDef := pulumi.All(d.Out.Image.ImageName, s.Env, s.DockerLabels, s.SidecarContainers, logConfiguration).ApplyT(
+	containerDef := containerDefinitions(ContainerDefinition{
+		Name:             s.Name,
+		PortMappings:     s.Ports,
+		LinuxParameters:  s.LinuxParameters,
+		MountPoints:      s.MountPoints,
+		LogConfiguration: logConfiguration,
+	}, d.Out.ImageName, d.Out.RepositoryCredentials, s.Env, s.Secrets, s.DockerLabels, s.SidecarContainers)
+
+	// Setup ECS task & service
+	taskName := fmt.Sprintf("%v-task", s.Name)
+	var family pulumi.StringInput = pulumi.String(taskName)
+	if s.Task.Family != nil {
+		family = s.Task.Family
+	}
+
+	appTask, err := ecs.NewTaskDefinition(ctx, taskName, taskDefinitionArgs(s.Task, family, taskName, containerDef), opts...)
+	if err != nil {
+		return err
+	}
+
+	s.Out.Task = appTask
+	s.Exports.export(ctx, s.Name, "SERVICE-TASK-DEFINITION-ARN", appTask.Arn)
+
+	serviceName := fmt.Sprintf("%v-svc", s.Name)
+	s.Service.TaskDefinition = appTask.Arn
+
+	if s.ServiceConnect != nil {
+		s.Service.ServiceConnectConfiguration = s.ServiceConnect.Configuration(logConfiguration)
+	}
+
+	if s.Capacity != nil {
+		s.Service.CapacityProviderStrategies = s.Capacity.Strategies()
+	}
+
+	serviceOpts := append([]pulumi.ResourceOption{}, opts...)
+
+	// Capacity provider strategies, including the cluster's default, fail until
+	// the providers are registered with the cluster.
+	if s.ECS != nil && s.ECS.Out.CapacityProviders != nil {
+		serviceOpts = append(serviceOpts, pulumi.DependsOn([]pulumi.Resource{s.ECS.Out.CapacityProviders}))
+	}
+
+	if s.PreDeploy != nil {
+		preDeployName := fmt.Sprintf("%v-predeploy-task", s.Name)
+		preDeployTask, err := ecs.NewTaskDefinition(ctx, preDeployName, taskDefinitionArgs(s.Task, pulumi.String(preDeployName), preDeployName,
+			containerDefinitions(ContainerDefinition{
+				Name:             s.Name,
+				Command:          s.PreDeploy.Command,
+				LinuxParameters:  s.LinuxParameters,
+				MountPoints:      s.MountPoints,
+				LogConfiguration: logConfiguration,
+			}, d.Out.ImageName, d.Out.RepositoryCredentials, s.Env, s.Secrets, s.DockerLabels, nil),
+		), opts...)
+		if err != nil {
+			return err
+		}
+		s.PreDeploy.Out.Task = preDeployTask
+
+		// Hold the service update until the pre-deploy task exits successfully.
+		preDeployed, err := s.PreDeploy.Run(ctx, s.Name, s.Region, s.Name, s.Service, preDeployTask, opts...)
+		if err != nil {
+			return err
+		}
+		serviceOpts = append(serviceOpts, pulumi.DependsOn([]pulumi.Resource{preDeployed}))
+	}
+
+	if s.autoscaled {
+		serviceOpts = append(serviceOpts, pulumi.IgnoreChanges([]string{"desiredCount"}))
+	}
+
+	service, err := ecs.NewService(ctx, serviceName, s.Service, serviceOpts...)
+	if err != nil {
+		return err
+	}
+
+	s.Out.Service = service
+	s.Exports.export(ctx, s.Name, "SERVICE-ID", service.ID())
+	s.Exports.export(ctx, s.Name, "SERVICE-NAME", service.Name)
+
+	if s.Out.TaskRole != nil {
+		s.Exports.export(ctx, s.Name, "SERVICE-TASK-ROLE-ARN", s.Out.TaskRole.Arn)
+	}
+
+	return nil
+}
+
+// taskDefinitionArgs copies the caller's task definition args, setting the
+// generated family, container definitions and Name tag. The caller's tags are
+// merged with the generated tag; setting the Name tag is reported as an error.
+func taskDefinitionArgs(task *ecs.TaskDefinitionArgs, family pulumi.StringInput, name string, containerDef pulumi.StringInput) *ecs.TaskDefinitionArgs {
+	args := *task
+	args.Family = family
+	args.ContainerDefinitions = containerDef
+	args.Tags = mergeTags(pulumi.StringMap{"Name": pulumi.String(name)}, task.Tags)
+
+	return &args
+}
+
+// mergeTags merges the caller's tags with generated tags, failing if the
+// caller sets a generated key instead of silently overwriting either value.
+func mergeTags(generated pulumi.StringMap, tags pulumi.StringMapInput) pulumi.StringMapInput {
+	if tags == nil {
+		return generated
+	}
+
+	return pulumi.All(generated, tags).ApplyT(func(args []interface{}) (map[string]string, error) {
+		merged := map[string]string{}
+		for key, value := range args[0].(map[string]string) {
+			merged[key] = value
+		}
+
+		for key, value := range args[1].(map[string]string) {
+			if _, ok := merged[key]; ok {
+				return nil, fmt.Errorf("tag <%v> conflicts with a generated tag", key)
+			}
+			merged[key] = value
+		}
+
+		return merged, nil
+	}).(pulumi.StringMapOutput)
+}
+
+// containerDefinitions renders the JSON container definitions for a task. The
+// primary container is described by def, with its image, repository
+// credentials, environment, secrets and docker labels resolved from the given
+// inputs, followed by any sidecars.
+func containerDefinitions(def ContainerDefinition, image, repositoryCredentials pulumi.StringInput, env, secrets, dockerLabels pulumi.StringMapInput, sidecarContainers pulumi.StringArrayInput) pulumi.StringOutput {
+	if repositoryCredentials == nil {
+		repositoryCredentials = pulumi.String("")
+	}
+
+	if env == nil {
+		env = pulumi.StringMap{}
+	}
+
+	if secrets == nil {
+		secrets = pulumi.StringMap{}
+	}
+
+	if dockerLabels == nil {
+		dockerLabels = pulumi.StringMap{}
+	}
+
+	if sidecarContainers == nil {
+		sidecarContainers = pulumi.StringArray{}
+	}
+
+	return pulumi.All(image, env, secrets, dockerLabels, sidecarContainers, repositoryCredentials).ApplyT(
 		func(args []interface{}) (string, error) {
 			image := args[0].(string)
 
@@ -102,36 +578,36 @@ func (s *Service) Run(ctx *pulumi.Context, opts ...pulumi.ResourceOption) error
 				return "", fmt.Errorf("failed to coerce env")
 			}
 
-			dockerLabels, ok := args[2].(map[string]string)
+			secretMap, ok := args[2].(map[string]string)
 			if !ok {
-				return "", fmt.Errorf("failed to coerce dockerLabels")
+				return "", fmt.Errorf("failed to coerce secrets")
 			}
 
-			sidecarContainers, ok := args[3].([]string)
+			dockerLabels, ok := args[3].(map[string]string)
 			if !ok {
-				return "", fmt.Errorf("Failed to coerce sidecar containers")
+				return "", fmt.Errorf("failed to coerce dockerLabels")
 			}
 
-			logConfig, ok := args[4].(*ContainerLogConfig)
+			sidecarContainers, ok := args[4].([]string)
 			if !ok {
-				return "", fmt.Errorf("Failed to coerce container log config")
+				return "", fmt.Errorf("Failed to coerce sidecar containers")
 			}
 
-			env := []ContainerEnvVar{}
+			def.Image = image
+			def.DockerLabels = dockerLabels
 
-			for key, value := range envMap {
-				env = append(env, ContainerEnvVar{Name: key, Value: value})
+			if credentials := args[5].(string); credentials != "" {
+				def.RepositoryCredentials = &ContainerRepositoryCredentials{CredentialsParameter: credentials}
 			}
 
-			def := ContainerDefinition{
-				Name:             s.Name,
-				Image:            image,
-				PortMappings:     s.Ports,
-				LinuxParameters:  s.LinuxParameters,
-				MountPoints:      s.MountPoints,
-				Environment:      env,
-				DockerLabels:     dockerLabels,
-				LogConfiguration: logConfig,
+			// Sort by name so the rendered definition is stable between runs.
+			def.Environment = []ContainerEnvVar{}
+			for _, key := range sortedKeys(envMap) {
+				def.Environment = append(def.Environment, ContainerEnvVar{Name: key, Value: envMap[key]})
+			}
+
+			for _, key := range sortedKeys(secretMap) {
+				def.Secrets = append(def.Secrets, ContainerSecret{Name: key, ValueFrom: secretMap[key]})
 			}
 
 			if err := def.Validate(); err != nil {
@@ -145,61 +621,21 @@ func (s *Service) Run(ctx *pulumi.Context, opts ...pulumi.ResourceOption) error
 
 			return "[" + strings.Join(containers, ",") + "]", nil
 		},
-	).(pulumi.StringInput)
-
-	// Setup ECS task & service
-	taskName := fmt.Sprintf("%v-task", s.Name)
-	appTask, err := ecs.NewTaskDefinition(ctx, taskName, &ecs.TaskDefinitionArgs{
-		Family: pulumi.String(taskName),
-		Tags: pulumi.StringMap{
-			"Name": pulumi.String(taskName),
-		},
-		Cpu:                     s.Task.Cpu,
-		Memory:                  s.Task.Memory,
-		NetworkMode:             s.Task.NetworkMode,
-		RequiresCompatibilities: s.Task.RequiresCompatibilities,
-		ExecutionRoleArn:        s.Task.ExecutionRoleArn,
-		ContainerDefinitions:    containerDef,
-		Volumes:                 s.Task.Volumes,
-		TaskRoleArn:             s.Task.TaskRoleArn,
-	}, opts...)
-	if err != nil {
-		return err
-	}
-
-	s.Out.Task = appTask
-
-	serviceName := fmt.Sprintf("%v-svc", s.Name)
-	s.Service.TaskDefinition = appTask.Arn
+	).(pulumi.StringOutput)
+}
 
-	service, err := ecs.NewService(ctx, serviceName, s.Service, opts...)
-	if err != nil {
-		return err
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
 
-	s.Out.Service = service
-
-	return nil
+	return keys
 }
 
+// ServiceLogConfiguration creates the service's log group with the given
+// retention, 0 never expiring events, and returns the default awslogs configuration for its containers.
 func ServiceLogConfiguration(ctx *pulumi.Context, name, region string, logRetentionDays int) (*ContainerLogConfig, error) {
-	logGroup := fmt.Sprintf("/fargate/service/%v", name)
-	_, err := cloudwatch.NewLogGroup(ctx, logGroup, &cloudwatch.LogGroupArgs{
-		Name:            pulumi.String(logGroup),
-		Tags:            pulumi.StringMap{},
-		RetentionInDays: pulumi.Int(logRetentionDays),
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	return &ContainerLogConfig{
-		LogDriver:     "awslogs",
-		SecretOptions: nil,
-		Options: map[string]interface{}{
-			"awslogs-group":         logGroup,
-			"awslogs-region":        region,
-			"awslogs-stream-prefix": "fargate",
-		},
-	}, nil
+	return ServiceLogConfigurationWithOptions(ctx, name, region, &LogOptions{RetentionDays: logRetentionDays})
 }
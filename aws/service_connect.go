@@ -0,0 +1,113 @@
+package aws
+
+import (
+	"fmt"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ecs"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// ServiceConnect configures ECS Service Connect for a service. A service with
+// no Services is a client only: it can reach other services in the namespace
+// but isn't discoverable itself.
+type ServiceConnect struct {
+	// Namespace is the Cloud Map namespace name or ARN. Defaults to the cluster's Service Connect
+	// default, so it is required unless Service.ECS sets ServiceConnectNamespace.
+	Namespace pulumi.StringInput
+
+	Services []ServiceConnectService
+}
+
+// ServiceConnectService publishes a named container port in the namespace.
+type ServiceConnectService struct {
+	// PortName references a ContainerPortMapping.Name of the service.
+	PortName string
+
+	// DiscoveryName defaults to PortName.
+	DiscoveryName string
+
+	Aliases []ServiceConnectAlias
+}
+
+// ServiceConnectAlias is the DNS name and port clients use to reach a service.
+type ServiceConnectAlias struct {
+	DNSName string
+	Port    int
+}
+
+func (c *ServiceConnect) Validate(ports []ContainerPortMapping) error {
+	names := map[string]bool{}
+	for _, port := range ports {
+		if port.Name != "" {
+			names[port.Name] = true
+		}
+	}
+
+	for idx, svc := range c.Services {
+		if svc.PortName == "" {
+			return fmt.Errorf("missing ServiceConnect.Services[%d].PortName", idx)
+		}
+
+		if !names[svc.PortName] {
+			return fmt.Errorf("ServiceConnect.Services[%d].PortName <%v> does not match a named Service.Ports entry", idx, svc.PortName)
+		}
+
+		for _, alias := range svc.Aliases {
+			if alias.Port <= 0 {
+				return fmt.Errorf("ServiceConnect.Services[%d] alias <%v> is missing a port", idx, alias.DNSName)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Configuration returns the service's Service Connect configuration, sending
+// the proxy's logs to the service's log group.
+func (c *ServiceConnect) Configuration(logConfig *ContainerLogConfig) *ecs.ServiceServiceConnectConfigurationArgs {
+	options := pulumi.StringMap{
+		"awslogs-group":         pulumi.String(fmt.Sprint(logConfig.Options["awslogs-group"])),
+		"awslogs-region":        pulumi.String(fmt.Sprint(logConfig.Options["awslogs-region"])),
+		"awslogs-stream-prefix": pulumi.String("service-connect"),
+	}
+
+	services := ecs.ServiceServiceConnectConfigurationServiceArray{}
+	for _, svc := range c.Services {
+		discoveryName := svc.DiscoveryName
+		if discoveryName == "" {
+			discoveryName = svc.PortName
+		}
+
+		aliases := ecs.ServiceServiceConnectConfigurationServiceClientAliasArray{}
+		for _, alias := range svc.Aliases {
+			aliasArgs := &ecs.ServiceServiceConnectConfigurationServiceClientAliasArgs{
+				Port: pulumi.Int(alias.Port),
+			}
+			if alias.DNSName != "" {
+				aliasArgs.DnsName = pulumi.String(alias.DNSName)
+			}
+			aliases = append(aliases, aliasArgs)
+		}
+
+		services = append(services, &ecs.ServiceServiceConnectConfigurationServiceArgs{
+			PortName:      pulumi.String(svc.PortName),
+			DiscoveryName: pulumi.String(discoveryName),
+			ClientAlias:   aliases,
+		})
+	}
+
+	args := &ecs.ServiceServiceConnectConfigurationArgs{
+		Enabled:  pulumi.Bool(true),
+		Services: services,
+		LogConfiguration: &ecs.ServiceServiceConnectConfigurationLogConfigurationArgs{
+			LogDriver: pulumi.String(logConfig.LogDriver),
+			Options:   options,
+		},
+	}
+
+	if c.Namespace != nil {
+		args.Namespace = c.Namespace
+	}
+
+	return args
+}
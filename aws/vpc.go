@@ -3,6 +3,7 @@ package aws
 import (
 	"fmt"
 
+	awssdk "github.com/pulumi/pulumi-aws/sdk/v6/go/aws"
 	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 )
@@ -12,17 +13,113 @@ type VPC struct {
 	CidrBlock string
 	Region    string
 
+	// PublicSubnetCidrBlocks and PrivateSubnetCidrBlocks have one CIDR block per
+	// availability zone, each of which gets a public and a private subnet.
 	PublicSubnetCidrBlocks  []string
 	PrivateSubnetCidrBlocks []string
 
+	// AvailabilityZones are the zone names, i.e. <us-east-1a>, in CIDR block
+	// order. Defaults to the region's first available zones.
+	AvailabilityZones []string
+
+	// Deprecated: use AvailabilityZones.
 	AZSuffix1 rune
+	// Deprecated: use AvailabilityZones.
 	AZSuffix2 rune
 
+	// NATMode is how private subnets reach the internet, one of NATModeSingle,
+	// NATModePerAZ, NATModeInstance or NATModeNone. Defaults to NATModeSingle.
+	NATMode string
+
+	// NATInstanceType defaults to t4g.nano with NATModeInstance.
+	// NATInstanceAMIParameter is the SSM parameter holding the AMI ID and must
+	// match the instance type's architecture. Defaults to arm64 Amazon Linux 2023.
+	NATInstanceType         string
+	NATInstanceAMIParameter string
+
+	// Endpoints optionally creates VPC endpoints for the AWS services tasks use,
+	// so they keep working with NATModeNone.
+	Endpoints *VPCEndpoints
+
+	// FlowLogs optionally captures the VPC's traffic to CloudWatch Logs or S3.
+	FlowLogs *FlowLogs
+
+	// Exports namespaces or disables the VPC's stack exports.
+	Exports *Exports
+
 	Out struct {
-		VPC            *ec2.Vpc
-		PublicSubnets  []*ec2.Subnet
-		PrivateSubnets []*ec2.Subnet
+		VPC                *ec2.Vpc
+		PublicSubnets      []*ec2.Subnet
+		PrivateSubnets     []*ec2.Subnet
+		PrivateRouteTables []*ec2.RouteTable
+		InternetGateway    *ec2.InternetGateway
+		NATGateways        []*ec2.NatGateway
+		NATInstance        *ec2.Instance
+
+		// NATGateway is the shared gateway of NATModeSingle, also in NATGateways.
+		NATGateway *ec2.NatGateway
+	}
+}
+
+// VPCOutputs are the VPC values other stacks consume.
+type VPCOutputs struct {
+	VPCID             pulumi.StringOutput
+	InternetGatewayID pulumi.StringOutput
+	NATGatewayIDs     pulumi.StringArrayOutput
+	PublicSubnetIDs   pulumi.StringArrayOutput
+	PrivateSubnetIDs  pulumi.StringArrayOutput
+
+	// NATGatewayID is only exported with NATModeSingle, otherwise it is nil.
+	NATGatewayID pulumi.StringPtrOutput
+}
+
+// Outputs returns the VPC's outputs once it has been run.
+func (v *VPC) Outputs() *VPCOutputs {
+	outputs := &VPCOutputs{
+		VPCID:             v.Out.VPC.ID().ToStringOutput(),
+		InternetGatewayID: v.Out.InternetGateway.ID().ToStringOutput(),
+		NATGatewayID:      noStringPtr(),
+		NATGatewayIDs:     natGatewayIDs(v.Out.NATGateways).ToStringArrayOutput(),
+		PublicSubnetIDs:   subnetIDs(v.Out.PublicSubnets).ToStringArrayOutput(),
+		PrivateSubnetIDs:  subnetIDs(v.Out.PrivateSubnets).ToStringArrayOutput(),
+	}
+
+	if v.Out.NATGateway != nil {
+		outputs.NATGatewayID = v.Out.NATGateway.ID().ToStringOutput().ToStringPtrOutput()
 	}
+
+	return outputs
+}
+
+// VPCOutputsFromStack reads the outputs of the named VPC from the stack that
+// deployed it, which must have been deployed with the same Exports.
+func VPCOutputsFromStack(ref *pulumi.StackReference, name string, exports *Exports) *VPCOutputs {
+	return &VPCOutputs{
+		VPCID:             exports.stringOutput(ref, name, "VPC-ID"),
+		InternetGatewayID: exports.stringOutput(ref, name, "IGW-ID"),
+		NATGatewayID:      exports.stringPtrOutput(ref, name, "NAT-GATEWAY-ID"),
+		NATGatewayIDs:     exports.stringArrayOutput(ref, name, "NAT-GATEWAY-IDS"),
+		PublicSubnetIDs:   exports.stringArrayOutput(ref, name, "PUBLIC-SUBNET-IDS"),
+		PrivateSubnetIDs:  exports.stringArrayOutput(ref, name, "PRIVATE-SUBNET-IDS"),
+	}
+}
+
+func subnetIDs(subnets []*ec2.Subnet) pulumi.StringArray {
+	ids := pulumi.StringArray{}
+	for _, subnet := range subnets {
+		ids = append(ids, subnet.ID().ToStringOutput())
+	}
+
+	return ids
+}
+
+func subnetResources(subnets []*ec2.Subnet) []pulumi.Resource {
+	resources := []pulumi.Resource{}
+	for _, subnet := range subnets {
+		resources = append(resources, subnet)
+	}
+
+	return resources
 }
 
 func (v *VPC) ID() pulumi.IDOutput {
@@ -38,37 +135,116 @@ func (v *VPC) Validate() error {
 		return fmt.Errorf("missing VPC.CidrBlock")
 	}
 
-	if v.PublicSubnetCidrBlocks == nil {
-		return fmt.Errorf("missing VPC.PublicSubnetCidrBLocks")
+	if len(v.PublicSubnetCidrBlocks) < 2 {
+		return fmt.Errorf("VPC.PublicSubnetCidrBlocks must have at least 2 CIDR blocks")
 	}
 
-	if len(v.PublicSubnetCidrBlocks) < 2 {
-		return fmt.Errorf("VPC.PublicSubnetCidrBLocks must have at least 2 CIDR blocks")
+	if len(v.PrivateSubnetCidrBlocks) != len(v.PublicSubnetCidrBlocks) {
+		return fmt.Errorf("VPC.PrivateSubnetCidrBlocks must have a CIDR block per public subnet")
 	}
 
-	if v.PrivateSubnetCidrBlocks == nil {
-		return fmt.Errorf("missing VPC.PrivateSubnetCidrBlocks")
+	if v.Region == "" {
+		return fmt.Errorf("missing VPC.Region")
 	}
 
-	if len(v.PrivateSubnetCidrBlocks) < 2 {
-		return fmt.Errorf("VPC.PrivateSubnetCidrBlocks must have at least 2 CIDR blocks")
+	if v.NATMode == "" {
+		v.NATMode = NATModeSingle
 	}
 
-	if v.Region == "" {
-		return fmt.Errorf("missing VPC.Region")
+	switch v.NATMode {
+	case NATModeSingle, NATModePerAZ, NATModeNone:
+		if v.NATInstanceType != "" || v.NATInstanceAMIParameter != "" {
+			return fmt.Errorf("VPC.NATInstanceType and VPC.NATInstanceAMIParameter require NATModeInstance")
+		}
+	case NATModeInstance:
+		if v.NATInstanceType == "" {
+			v.NATInstanceType = "t4g.nano"
+		}
+
+		if v.NATInstanceAMIParameter == "" {
+			v.NATInstanceAMIParameter = "/aws/service/ami-amazon-linux-latest/al2023-ami-kernel-default-arm64"
+		}
+	default:
+		return fmt.Errorf("VPC.NATMode <%v> is invalid - must be single, per-az, instance or none", v.NATMode)
+	}
+
+	if v.Endpoints != nil {
+		if err := v.Endpoints.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if v.FlowLogs != nil {
+		if err := v.FlowLogs.Validate(); err != nil {
+			return err
+		}
 	}
 
-	if v.AZSuffix1 < 'a' || v.AZSuffix1 > 'z' {
-		return fmt.Errorf("invalid AZSufix1")
+	if v.AZSuffix1 != 0 || v.AZSuffix2 != 0 {
+		if v.AvailabilityZones != nil {
+			return fmt.Errorf("VPC.AZSuffix1 and VPC.AZSuffix2 cannot be combined with VPC.AvailabilityZones")
+		}
+
+		if v.AZSuffix1 < 'a' || v.AZSuffix1 > 'z' {
+			return fmt.Errorf("invalid AZSufix1")
+		}
+
+		if v.AZSuffix2 < 'a' || v.AZSuffix2 > 'z' {
+			return fmt.Errorf("invalid AZSufix2")
+		}
+
+		if len(v.PublicSubnetCidrBlocks) != 2 {
+			return fmt.Errorf("VPC.AZSuffix1 and VPC.AZSuffix2 only support 2 CIDR blocks - use VPC.AvailabilityZones")
+		}
 	}
 
-	if v.AZSuffix2 < 'a' || v.AZSuffix2 > 'z' {
-		return fmt.Errorf("invalid AZSufix2")
+	if v.AvailabilityZones != nil && len(v.AvailabilityZones) != len(v.PublicSubnetCidrBlocks) {
+		return fmt.Errorf("VPC.AvailabilityZones must have a zone per CIDR block")
 	}
 
 	return nil
 }
 
+// zones returns the availability zone of each CIDR block, discovering the
+// provider region's available zones unless they were given. Discovery fails
+// when the provider's region is not VPC.Region.
+func (v *VPC) zones(ctx *pulumi.Context) ([]string, error) {
+	if v.AvailabilityZones != nil {
+		return v.AvailabilityZones, nil
+	}
+
+	if v.AZSuffix1 != 0 {
+		return []string{
+			fmt.Sprintf("%v%s", v.Region, string(v.AZSuffix1)),
+			fmt.Sprintf("%v%s", v.Region, string(v.AZSuffix2)),
+		}, nil
+	}
+
+	region, err := awssdk.GetRegion(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if region.Name != v.Region {
+		return nil, fmt.Errorf("VPC.Region <%v> is invalid - must be the AWS provider's region %v to discover availability zones",
+			v.Region, region.Name)
+	}
+
+	available, err := awssdk.GetAvailabilityZones(ctx, &awssdk.GetAvailabilityZonesArgs{
+		State: pulumi.StringRef("available"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(available.Names) < len(v.PublicSubnetCidrBlocks) {
+		return nil, fmt.Errorf("VPC region %v has %d available zones but %d CIDR blocks were given",
+			v.Region, len(available.Names), len(v.PublicSubnetCidrBlocks))
+	}
+
+	return available.Names[:len(v.PublicSubnetCidrBlocks)], nil
+}
+
 func (v *VPC) Run(ctx *pulumi.Context) error {
 	if err := v.Validate(); err != nil {
 		return err
@@ -89,64 +265,52 @@ func (v *VPC) Run(ctx *pulumi.Context) error {
 	}
 	v.Out.VPC = vpc
 
-	ctx.Export("VPC-ID", vpc.ID())
+	v.Exports.export(ctx, v.Name, "VPC-ID", vpc.ID())
 
-	// Create public sub
-	publicSubnetName := fmt.Sprintf("%v-public-subnet-1", v.Name)
-	publicSubnet1, err := ec2.NewSubnet(ctx, publicSubnetName, &ec2.SubnetArgs{
-		Tags: pulumi.StringMap{
-			"Name": pulumi.String(publicSubnetName),
-		},
-		VpcId:            vpc.ID(),
-		CidrBlock:        pulumi.String(v.PublicSubnetCidrBlocks[0]),
-		AvailabilityZone: pulumi.StringPtr(fmt.Sprintf("%v%s", v.Region, string(v.AZSuffix1))),
-	})
-	if err != nil {
-		return err
-	}
-
-	publicSubnet2Name := fmt.Sprintf("%v-public-subnet-2", v.Name)
-	publicSubnet2, err := ec2.NewSubnet(ctx, publicSubnet2Name, &ec2.SubnetArgs{
-		Tags: pulumi.StringMap{
-			"Name": pulumi.String(publicSubnet2Name),
-		},
-		VpcId:            vpc.ID(),
-		CidrBlock:        pulumi.String(v.PublicSubnetCidrBlocks[1]),
-		AvailabilityZone: pulumi.StringPtr(fmt.Sprintf("%v%s", v.Region, string(v.AZSuffix2))),
-	})
-	if err != nil {
-		return err
+	if v.FlowLogs != nil {
+		if err := v.flowLogs(ctx); err != nil {
+			return err
+		}
 	}
 
-	// Create private subnets
-	privateSubnet1Name := fmt.Sprintf("%v-private-subnet-1", v.Name)
-	privateSubnet1, err := ec2.NewSubnet(ctx, privateSubnet1Name, &ec2.SubnetArgs{
-		Tags: pulumi.StringMap{
-			"Name": pulumi.String(privateSubnet1Name),
-		},
-		VpcId:            vpc.ID(),
-		CidrBlock:        pulumi.String(v.PrivateSubnetCidrBlocks[0]),
-		AvailabilityZone: pulumi.StringPtr(fmt.Sprintf("%v%s", v.Region, string(v.AZSuffix1))),
-	})
+	zones, err := v.zones(ctx)
 	if err != nil {
 		return err
 	}
 
-	privateSubnet2Name := fmt.Sprintf("%v-private-subnet-2", v.Name)
-	privateSubnet2, err := ec2.NewSubnet(ctx, privateSubnet2Name, &ec2.SubnetArgs{
-		Tags: pulumi.StringMap{
-			"Name": pulumi.String(privateSubnet2Name),
-		},
-		VpcId:            vpc.ID(),
-		CidrBlock:        pulumi.String(v.PrivateSubnetCidrBlocks[1]),
-		AvailabilityZone: pulumi.StringPtr(fmt.Sprintf("%v%s", v.Region, string(v.AZSuffix2))),
-	})
-	if err != nil {
-		return err
+	// Create a public and a private subnet per zone
+	for idx, zone := range zones {
+		publicSubnetName := fmt.Sprintf("%v-public-subnet-%d", v.Name, idx+1)
+		publicSubnet, err := ec2.NewSubnet(ctx, publicSubnetName, &ec2.SubnetArgs{
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(publicSubnetName),
+			},
+			VpcId:            vpc.ID(),
+			CidrBlock:        pulumi.String(v.PublicSubnetCidrBlocks[idx]),
+			AvailabilityZone: pulumi.StringPtr(zone),
+		})
+		if err != nil {
+			return err
+		}
+		v.Out.PublicSubnets = append(v.Out.PublicSubnets, publicSubnet)
+
+		privateSubnetName := fmt.Sprintf("%v-private-subnet-%d", v.Name, idx+1)
+		privateSubnet, err := ec2.NewSubnet(ctx, privateSubnetName, &ec2.SubnetArgs{
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(privateSubnetName),
+			},
+			VpcId:            vpc.ID(),
+			CidrBlock:        pulumi.String(v.PrivateSubnetCidrBlocks[idx]),
+			AvailabilityZone: pulumi.StringPtr(zone),
+		})
+		if err != nil {
+			return err
+		}
+		v.Out.PrivateSubnets = append(v.Out.PrivateSubnets, privateSubnet)
 	}
 
-	v.Out.PublicSubnets = []*ec2.Subnet{publicSubnet1, publicSubnet2}
-	v.Out.PrivateSubnets = []*ec2.Subnet{privateSubnet1, privateSubnet2}
+	v.Exports.export(ctx, v.Name, "PUBLIC-SUBNET-IDS", subnetIDs(v.Out.PublicSubnets))
+	v.Exports.export(ctx, v.Name, "PRIVATE-SUBNET-IDS", subnetIDs(v.Out.PrivateSubnets))
 
 	igName := fmt.Sprintf("%v-internet-gateway", v.Name)
 	internetGateway, err := ec2.NewInternetGateway(ctx, igName, &ec2.InternetGatewayArgs{
@@ -159,32 +323,14 @@ func (v *VPC) Run(ctx *pulumi.Context) error {
 		return err
 	}
 
-	ctx.Export("IGW-ID", internetGateway.ID())
-
-	eipName := fmt.Sprintf("%v-nat-gateway-ip", v.Name)
-	elasticIPAllocation, err := ec2.NewEip(ctx, eipName, &ec2.EipArgs{
-		Tags: pulumi.StringMap{
-			"Name": pulumi.String(eipName),
-		},
-		Vpc: pulumi.Bool(true),
-	})
-	if err != nil {
-		return err
-	}
+	v.Out.InternetGateway = internetGateway
+	v.Exports.export(ctx, v.Name, "IGW-ID", internetGateway.ID())
 
-	natName := fmt.Sprintf("%v-nat-gateway", v.Name)
-	natGateway, err := ec2.NewNatGateway(ctx, natName, &ec2.NatGatewayArgs{
-		Tags: pulumi.StringMap{
-			"Name": pulumi.String(natName),
-		},
-		AllocationId: elasticIPAllocation.ID(),
-		SubnetId:     v.Out.PublicSubnets[0].ID(),
-	}, pulumi.DependsOn([]pulumi.Resource{v.Out.PublicSubnets[0], elasticIPAllocation}))
+	privateRoutes, err := v.natRoutes(ctx)
 	if err != nil {
 		return err
 	}
-
-	ctx.Export("NAT-GATEWAY-ID", natGateway.ID())
+	v.Exports.export(ctx, v.Name, "NAT-GATEWAY-IDS", natGatewayIDs(v.Out.NATGateways))
 
 	pubRouteTableName := fmt.Sprintf("%v-public-route-table", v.Name)
 	publicSubnetRouteTable, err := ec2.NewRouteTable(ctx, pubRouteTableName, &ec2.RouteTableArgs{
@@ -204,54 +350,50 @@ func (v *VPC) Run(ctx *pulumi.Context) error {
 		return err
 	}
 
-	privateRouteTableName := fmt.Sprintf("%v-private-route-table", v.Name)
-	privateSubnetRouteTable, err := ec2.NewRouteTable(ctx, privateRouteTableName, &ec2.RouteTableArgs{
-		VpcId: vpc.ID(),
-		Tags: pulumi.StringMap{
-			"Name": pulumi.String(privateRouteTableName),
-		},
-		Routes: ec2.RouteTableRouteArray{
-			&ec2.RouteTableRouteArgs{
-				CidrBlock:    pulumi.String("0.0.0.0/0"),
-				NatGatewayId: natGateway.ID(),
+	// Private subnets share a route table unless each zone has its own NAT gateway.
+	for idx, routes := range privateRoutes {
+		privateRouteTableName := fmt.Sprintf("%v-private-route-table", v.Name)
+		if len(privateRoutes) > 1 {
+			privateRouteTableName = fmt.Sprintf("%v-private-route-table-%d", v.Name, idx+1)
+		}
+
+		privateSubnetRouteTable, err := ec2.NewRouteTable(ctx, privateRouteTableName, &ec2.RouteTableArgs{
+			VpcId: vpc.ID(),
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(privateRouteTableName),
 			},
-		},
-	})
-
-	if err != nil {
-		return err
+			Routes: routes,
+		})
+		if err != nil {
+			return err
+		}
+		v.Out.PrivateRouteTables = append(v.Out.PrivateRouteTables, privateSubnetRouteTable)
 	}
 
-	_, err = ec2.NewRouteTableAssociation(ctx, fmt.Sprintf("%v-public-subnet-1-rt-assoc", v.Name), &ec2.RouteTableAssociationArgs{
-		SubnetId:     v.Out.PublicSubnets[0].ID(),
-		RouteTableId: publicSubnetRouteTable.ID(),
-	})
-	if err != nil {
-		return err
-	}
-
-	_, err = ec2.NewRouteTableAssociation(ctx, fmt.Sprintf("%v-public-subnet-2-rt-assoc", v.Name), &ec2.RouteTableAssociationArgs{
-		SubnetId:     v.Out.PublicSubnets[1].ID(),
-		RouteTableId: publicSubnetRouteTable.ID(),
-	})
-	if err != nil {
-		return err
+	for idx, subnet := range v.Out.PublicSubnets {
+		_, err = ec2.NewRouteTableAssociation(ctx, fmt.Sprintf("%v-public-subnet-%d-rt-assoc", v.Name, idx+1), &ec2.RouteTableAssociationArgs{
+			SubnetId:     subnet.ID(),
+			RouteTableId: publicSubnetRouteTable.ID(),
+		})
+		if err != nil {
+			return err
+		}
 	}
 
-	_, err = ec2.NewRouteTableAssociation(ctx, fmt.Sprintf("%v-private-subnet-1-rt-assoc", v.Name), &ec2.RouteTableAssociationArgs{
-		SubnetId:     privateSubnet1.ID(),
-		RouteTableId: privateSubnetRouteTable.ID(),
-	})
-	if err != nil {
-		return err
+	for idx, subnet := range v.Out.PrivateSubnets {
+		_, err = ec2.NewRouteTableAssociation(ctx, fmt.Sprintf("%v-private-subnet-%d-rt-assoc", v.Name, idx+1), &ec2.RouteTableAssociationArgs{
+			SubnetId:     subnet.ID(),
+			RouteTableId: v.Out.PrivateRouteTables[idx%len(v.Out.PrivateRouteTables)].ID(),
+		})
+		if err != nil {
+			return err
+		}
 	}
 
-	_, err = ec2.NewRouteTableAssociation(ctx, fmt.Sprintf("%v-private-subnet-2-rt-assoc", v.Name), &ec2.RouteTableAssociationArgs{
-		SubnetId:     privateSubnet2.ID(),
-		RouteTableId: privateSubnetRouteTable.ID(),
-	})
-	if err != nil {
-		return err
+	if v.Endpoints != nil {
+		if err := v.endpoints(ctx); err != nil {
+			return err
+		}
 	}
 
 	return nil
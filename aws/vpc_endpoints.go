@@ -0,0 +1,138 @@
+package aws
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// DefaultInterfaceEndpoints are the services Fargate tasks in private subnets
+// need to pull images from ECR, ship logs and read secrets.
+var DefaultInterfaceEndpoints = []string{
+	"ecr.api",
+	"ecr.dkr",
+	"logs",
+	"secretsmanager",
+	"ssm",
+	"sts",
+	"kms",
+}
+
+// VPCEndpoints are the VPC's gateway and interface endpoints, letting private
+// subnets reach AWS services without a NAT.
+type VPCEndpoints struct {
+	// Interfaces are the interface endpoint services, i.e. <ecr.api>, created in
+	// the private subnets with private DNS. Defaults to DefaultInterfaceEndpoints.
+	Interfaces []string
+
+	// DisableS3 skips the S3 gateway endpoint on the private route tables. ECR
+	// stores image layers in S3, so pulls need it when NAT is disabled.
+	DisableS3 bool
+
+	Out struct {
+		SecurityGroup *ec2.SecurityGroup
+		S3            *ec2.VpcEndpoint
+		Interfaces    map[string]*ec2.VpcEndpoint
+	}
+}
+
+func (e *VPCEndpoints) Validate() error {
+	if e.Interfaces == nil {
+		e.Interfaces = DefaultInterfaceEndpoints
+	}
+
+	seen := map[string]bool{}
+	for _, service := range e.Interfaces {
+		if service == "" || strings.HasPrefix(service, "com.amazonaws.") {
+			return fmt.Errorf("VPCEndpoints.Interfaces <%v> must be a service name, i.e. <ecr.api>", service)
+		}
+
+		if service == "s3" {
+			return fmt.Errorf("VPCEndpoints.Interfaces must not include s3 - it's a gateway endpoint")
+		}
+
+		if seen[service] {
+			return fmt.Errorf("VPCEndpoints.Interfaces has duplicate service <%v>", service)
+		}
+		seen[service] = true
+	}
+
+	return nil
+}
+
+// endpoints creates the VPC's endpoints after its private route tables.
+func (v *VPC) endpoints(ctx *pulumi.Context) error {
+	e := v.Endpoints
+
+	if !e.DisableS3 {
+		routeTableIDs := pulumi.StringArray{}
+		for _, routeTable := range v.Out.PrivateRouteTables {
+			routeTableIDs = append(routeTableIDs, routeTable.ID().ToStringOutput())
+		}
+
+		s3Name := fmt.Sprintf("%v-s3-endpoint", v.Name)
+		s3, err := ec2.NewVpcEndpoint(ctx, s3Name, &ec2.VpcEndpointArgs{
+			VpcId:           v.ID(),
+			ServiceName:     pulumi.Sprintf("com.amazonaws.%v.s3", v.Region),
+			VpcEndpointType: pulumi.String("Gateway"),
+			RouteTableIds:   routeTableIDs,
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(s3Name),
+			},
+		})
+		if err != nil {
+			return err
+		}
+		e.Out.S3 = s3
+	}
+
+	if len(e.Interfaces) == 0 {
+		return nil
+	}
+
+	// Interface endpoints share a security group accepting HTTPS from the VPC
+	sgName := fmt.Sprintf("%v-endpoints-sg", v.Name)
+	securityGroup, err := ec2.NewSecurityGroup(ctx, sgName, &ec2.SecurityGroupArgs{
+		VpcId:       v.ID(),
+		Description: pulumi.String("VPC interface endpoints"),
+		Ingress: ec2.SecurityGroupIngressArray{
+			ec2.SecurityGroupIngressArgs{
+				Protocol:   pulumi.String("tcp"),
+				FromPort:   pulumi.Int(443),
+				ToPort:     pulumi.Int(443),
+				CidrBlocks: pulumi.StringArray{pulumi.String(v.CidrBlock)},
+			},
+		},
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(sgName),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	e.Out.SecurityGroup = securityGroup
+
+	e.Out.Interfaces = map[string]*ec2.VpcEndpoint{}
+	for _, service := range e.Interfaces {
+		endpointName := fmt.Sprintf("%v-%v-endpoint", v.Name, strings.ReplaceAll(service, ".", "-"))
+		endpoint, err := ec2.NewVpcEndpoint(ctx, endpointName, &ec2.VpcEndpointArgs{
+			VpcId:             v.ID(),
+			ServiceName:       pulumi.Sprintf("com.amazonaws.%v.%v", v.Region, service),
+			VpcEndpointType:   pulumi.String("Interface"),
+			SubnetIds:         subnetIDs(v.Out.PrivateSubnets),
+			SecurityGroupIds:  pulumi.StringArray{securityGroup.ID()},
+			PrivateDnsEnabled: pulumi.Bool(true),
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(endpointName),
+			},
+		})
+		if err != nil {
+			return err
+		}
+		e.Out.Interfaces[service] = endpoint
+	}
+
+	return nil
+}
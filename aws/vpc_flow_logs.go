@@ -0,0 +1,201 @@
+package aws
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/cloudwatch"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/ec2"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/iam"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/s3"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// Flow log destinations for FlowLogs.Destination.
+const (
+	FlowLogsCloudWatch = "cloud-watch-logs"
+	FlowLogsS3         = "s3"
+)
+
+// FlowLogs captures the VPC's IP traffic to CloudWatch Logs or S3.
+type FlowLogs struct {
+	// Destination is FlowLogsCloudWatch or FlowLogsS3. Defaults to FlowLogsCloudWatch.
+	Destination string
+
+	// TrafficType is ACCEPT, REJECT or ALL. Defaults to ALL.
+	TrafficType string
+
+	// LogFormat is a custom record format, i.e. <${srcaddr} ${dstaddr} ${action}>.
+	// Defaults to the AWS default format.
+	LogFormat string
+
+	// MaxAggregationInterval is 60 or 600 seconds. Defaults to 600.
+	MaxAggregationInterval int
+
+	// RetentionDays must be one of LogRetentionDays. Defaults to 365. KmsKeyArn
+	// optionally encrypts the log group, its policy must allow CloudWatch Logs
+	// to use it. Both only apply to FlowLogsCloudWatch.
+	RetentionDays int
+	KmsKeyArn     pulumi.StringInput
+
+	// Bucket and Prefix are where FlowLogsS3 delivers records. Prefix is
+	// optional and cannot use the AWSLogs folder AWS writes under. Retention
+	// is left to the bucket's lifecycle rules.
+	Bucket *s3.Bucket
+	Prefix string
+
+	Out struct {
+		LogGroup *cloudwatch.LogGroup
+		Role     *iam.Role
+		FlowLog  *ec2.FlowLog
+	}
+}
+
+func (f *FlowLogs) Validate() error {
+	if f.Destination == "" {
+		f.Destination = FlowLogsCloudWatch
+	}
+
+	if f.TrafficType == "" {
+		f.TrafficType = "ALL"
+	}
+
+	if f.TrafficType != "ACCEPT" && f.TrafficType != "REJECT" && f.TrafficType != "ALL" {
+		return fmt.Errorf("FlowLogs.TrafficType <%v> is invalid - must be ACCEPT, REJECT or ALL", f.TrafficType)
+	}
+
+	if f.MaxAggregationInterval == 0 {
+		f.MaxAggregationInterval = 600
+	}
+
+	if f.MaxAggregationInterval != 60 && f.MaxAggregationInterval != 600 {
+		return fmt.Errorf("FlowLogs.MaxAggregationInterval <%d> is invalid - must be 60 or 600", f.MaxAggregationInterval)
+	}
+
+	switch f.Destination {
+	case FlowLogsCloudWatch:
+		if f.Bucket != nil || f.Prefix != "" {
+			return fmt.Errorf("FlowLogs.Bucket and FlowLogs.Prefix require FlowLogsS3")
+		}
+
+		if f.RetentionDays == 0 {
+			f.RetentionDays = 365
+		}
+
+		if err := (&LogOptions{RetentionDays: f.RetentionDays}).Validate(); err != nil {
+			return fmt.Errorf("FlowLogs.RetentionDays: %v", err)
+		}
+	case FlowLogsS3:
+		if f.Bucket == nil {
+			return fmt.Errorf("missing FlowLogs.Bucket")
+		}
+
+		if f.RetentionDays != 0 || f.KmsKeyArn != nil {
+			return fmt.Errorf("FlowLogs.RetentionDays and FlowLogs.KmsKeyArn require FlowLogsCloudWatch")
+		}
+
+		for _, folder := range strings.Split(f.Prefix, "/") {
+			if folder == "AWSLogs" {
+				return fmt.Errorf("FlowLogs.Prefix <%v> is invalid - AWSLogs is reserved by AWS", f.Prefix)
+			}
+		}
+	default:
+		return fmt.Errorf("FlowLogs.Destination <%v> is invalid - must be cloud-watch-logs or s3", f.Destination)
+	}
+
+	return nil
+}
+
+// flowLogs creates the VPC's flow log along with its log group and delivery
+// role when logging to CloudWatch.
+func (v *VPC) flowLogs(ctx *pulumi.Context) error {
+	f := v.FlowLogs
+
+	flowLogName := fmt.Sprintf("%v-flow-log", v.Name)
+	flowLogArgs := &ec2.FlowLogArgs{
+		VpcId:                  v.ID(),
+		TrafficType:            pulumi.String(f.TrafficType),
+		LogDestinationType:     pulumi.String(f.Destination),
+		MaxAggregationInterval: pulumi.Int(f.MaxAggregationInterval),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(flowLogName),
+		},
+	}
+
+	if f.LogFormat != "" {
+		flowLogArgs.LogFormat = pulumi.String(f.LogFormat)
+	}
+
+	if f.Destination == FlowLogsS3 {
+		flowLogArgs.LogDestination = f.Bucket.Arn
+		if f.Prefix != "" {
+			flowLogArgs.LogDestination = pulumi.Sprintf("%s/%s", f.Bucket.Arn, f.Prefix)
+		}
+	} else {
+		logGroupName := fmt.Sprintf("/vpc/%v/flow-logs", v.Name)
+		logGroup, err := cloudwatch.NewLogGroup(ctx, fmt.Sprintf("%v-flow-logs-log-group", v.Name), &cloudwatch.LogGroupArgs{
+			Name:            pulumi.String(logGroupName),
+			RetentionInDays: pulumi.Int(f.RetentionDays),
+			KmsKeyId:        f.KmsKeyArn,
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(logGroupName),
+			},
+		})
+		if err != nil {
+			return err
+		}
+		f.Out.LogGroup = logGroup
+
+		roleName := fmt.Sprintf("%v-flow-logs-role", v.Name)
+		role, err := iam.NewRole(ctx, roleName, &iam.RoleArgs{
+			AssumeRolePolicy: pulumi.String(
+				`{
+					"Version": "2012-10-17",
+					"Statement": [{
+						"Sid": "",
+						"Effect": "Allow",
+						"Principal": {
+							"Service": "vpc-flow-logs.amazonaws.com"
+						},
+						"Action": "sts:AssumeRole"
+					}]
+				}`),
+			Tags: pulumi.StringMap{
+				"Name": pulumi.String(roleName),
+			},
+		})
+		if err != nil {
+			return err
+		}
+		f.Out.Role = role
+
+		_, err = iam.NewRolePolicy(ctx, fmt.Sprintf("%v-flow-logs-policy", v.Name), &iam.RolePolicyArgs{
+			Role: role.Name,
+			Policy: PolicyDocument([]Permission{
+				{
+					Actions:   []string{"logs:CreateLogStream", "logs:PutLogEvents"},
+					Resources: pulumi.StringArray{logGroup.Arn, pulumi.Sprintf("%s:*", logGroup.Arn)},
+				},
+				{
+					// The describe actions do not support resource-level permissions.
+					Actions:   []string{"logs:DescribeLogGroups", "logs:DescribeLogStreams"},
+					Resources: pulumi.StringArray{pulumi.String("*")},
+				},
+			}),
+		})
+		if err != nil {
+			return err
+		}
+
+		flowLogArgs.LogDestination = logGroup.Arn
+		flowLogArgs.IamRoleArn = role.Arn
+	}
+
+	flowLog, err := ec2.NewFlowLog(ctx, flowLogName, flowLogArgs)
+	if err != nil {
+		return err
+	}
+	f.Out.FlowLog = flowLog
+
+	return nil
+}
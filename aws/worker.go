@@ -0,0 +1,365 @@
+package aws
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/appautoscaling"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/cloudwatch"
+	"github.com/pulumi/pulumi-aws/sdk/v6/go/aws/sqs"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// Worker is a service without ports that consumes an SQS queue. The queue URL
+// is injected into the container's env and the service scales on the backlog
+// per running task, down to zero when the queue is empty.
+//
+// Backlog per task is computed from the ECS/ContainerInsights RunningTaskCount
+// metric, so the service's ECS must be set and have Container Insights enabled.
+// Autoscaling owns the desired count, deployments leave it as is.
+type Worker struct {
+	Service *Service
+
+	// QueueEnvVar is the env var the queue URL is injected as. Defaults to QUEUE_URL.
+	QueueEnvVar string
+
+	VisibilityTimeoutSeconds int
+	// MaxReceiveCount is how many times a message is received before it is
+	// moved to the dead-letter queue. Defaults to 5.
+	MaxReceiveCount int
+
+	MinTasks int
+	MaxTasks int
+	// BacklogPerTask is the number of visible messages each task is expected
+	// to handle. Defaults to 10.
+	BacklogPerTask int
+
+	// Exports namespaces or disables the worker's stack exports, which are
+	// named after the service. The service's exports follow Service.Exports.
+	Exports *Exports
+
+	Out struct {
+		Queue           *sqs.Queue
+		DeadLetterQueue *sqs.Queue
+		ScalingTarget   *appautoscaling.Target
+		BacklogPolicy   *appautoscaling.Policy
+		ScaleFromZero   *appautoscaling.Policy
+		QueueAlarm      *cloudwatch.MetricAlarm
+	}
+}
+
+// WorkerOutputs are the worker values other stacks consume, i.e. to send
+// messages to its queue.
+type WorkerOutputs struct {
+	QueueURL           pulumi.StringOutput
+	QueueArn           pulumi.StringOutput
+	DeadLetterQueueURL pulumi.StringOutput
+	DeadLetterQueueArn pulumi.StringOutput
+}
+
+// Outputs returns the worker's outputs once it has been run.
+func (w *Worker) Outputs() *WorkerOutputs {
+	return &WorkerOutputs{
+		QueueURL:           w.Out.Queue.Url,
+		QueueArn:           w.Out.Queue.Arn,
+		DeadLetterQueueURL: w.Out.DeadLetterQueue.Url,
+		DeadLetterQueueArn: w.Out.DeadLetterQueue.Arn,
+	}
+}
+
+// WorkerOutputsFromStack reads the outputs of the worker of the named service
+// from the stack that deployed it, which must have been deployed with the same Exports.
+func WorkerOutputsFromStack(ref *pulumi.StackReference, name string, exports *Exports) *WorkerOutputs {
+	return &WorkerOutputs{
+		QueueURL:           exports.stringOutput(ref, name, "WORKER-QUEUE-URL"),
+		QueueArn:           exports.stringOutput(ref, name, "WORKER-QUEUE-ARN"),
+		DeadLetterQueueURL: exports.stringOutput(ref, name, "WORKER-DEAD-LETTER-QUEUE-URL"),
+		DeadLetterQueueArn: exports.stringOutput(ref, name, "WORKER-DEAD-LETTER-QUEUE-ARN"),
+	}
+}
+
+func (w *Worker) Validate() error {
+	if w.Service == nil {
+		return fmt.Errorf("missing Worker.Service")
+	}
+
+	if w.Service.ECS == nil {
+		return fmt.Errorf("missing Worker.Service.ECS - backlog scaling reads the cluster's Container Insights metrics")
+	}
+
+	if w.Service.ECS.ContainerInsights == ContainerInsightsDisabled {
+		return fmt.Errorf("Worker.Service.ECS must have Container Insights enabled for backlog scaling")
+	}
+
+	if len(w.Service.Ports) > 0 {
+		return fmt.Errorf("Worker.Service cannot have Ports")
+	}
+
+	if w.Service.Task != nil && w.Service.Task.TaskRoleArn != nil {
+		return fmt.Errorf("Worker.Service.Task.TaskRoleArn cannot be set - use Service.Permissions")
+	}
+
+	if w.QueueEnvVar == "" {
+		w.QueueEnvVar = "QUEUE_URL"
+	}
+
+	if w.VisibilityTimeoutSeconds == 0 {
+		w.VisibilityTimeoutSeconds = 30
+	}
+
+	if w.MaxReceiveCount == 0 {
+		w.MaxReceiveCount = 5
+	}
+
+	if w.BacklogPerTask == 0 {
+		w.BacklogPerTask = 10
+	}
+
+	if w.MinTasks < 0 {
+		return fmt.Errorf("Worker.MinTasks cannot be negative")
+	}
+
+	if w.MaxTasks < 1 || w.MaxTasks < w.MinTasks {
+		return fmt.Errorf("Worker.MaxTasks must be at least 1 and not less than Worker.MinTasks")
+	}
+
+	return nil
+}
+
+func (w *Worker) Run(ctx *pulumi.Context, opts ...pulumi.ResourceOption) error {
+	if err := w.Validate(); err != nil {
+		return err
+	}
+
+	s := w.Service
+
+	dlqName := fmt.Sprintf("%v-dlq", s.Name)
+	dlq, err := sqs.NewQueue(ctx, dlqName, &sqs.QueueArgs{
+		Name:                    pulumi.String(dlqName),
+		MessageRetentionSeconds: pulumi.Int(1209600),
+		SqsManagedSseEnabled:    pulumi.Bool(true),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(dlqName),
+		},
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	w.Out.DeadLetterQueue = dlq
+	w.Exports.export(ctx, s.Name, "WORKER-DEAD-LETTER-QUEUE-URL", dlq.Url)
+	w.Exports.export(ctx, s.Name, "WORKER-DEAD-LETTER-QUEUE-ARN", dlq.Arn)
+
+	queueName := fmt.Sprintf("%v-queue", s.Name)
+	queue, err := sqs.NewQueue(ctx, queueName, &sqs.QueueArgs{
+		Name:                     pulumi.String(queueName),
+		VisibilityTimeoutSeconds: pulumi.Int(w.VisibilityTimeoutSeconds),
+		SqsManagedSseEnabled:     pulumi.Bool(true),
+		RedrivePolicy: dlq.Arn.ApplyT(func(arn string) string {
+			return fmt.Sprintf(`{"deadLetterTargetArn":"%v","maxReceiveCount":%d}`, arn, w.MaxReceiveCount)
+		}).(pulumi.StringOutput),
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(queueName),
+		},
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	w.Out.Queue = queue
+	w.Exports.export(ctx, s.Name, "WORKER-QUEUE-URL", queue.Url)
+	w.Exports.export(ctx, s.Name, "WORKER-QUEUE-ARN", queue.Arn)
+
+	// Inject the queue URL and grant the task role consume permissions.
+	env := s.Env
+	if env == nil {
+		env = pulumi.StringMap{}
+	}
+	s.Env = pulumi.All(env, queue.Url).ApplyT(func(args []interface{}) (map[string]string, error) {
+		envMap, ok := args[0].(map[string]string)
+		if !ok {
+			return nil, fmt.Errorf("failed to coerce env")
+		}
+
+		merged := map[string]string{}
+		for key, value := range envMap {
+			merged[key] = value
+		}
+		merged[w.QueueEnvVar] = args[1].(string)
+
+		return merged, nil
+	}).(pulumi.StringMapOutput)
+
+	s.Permissions = append(s.Permissions, ConsumeQueue(queue.Arn))
+
+	// DesiredCount only sets the initial count, autoscaling owns it afterwards.
+	if s.Service != nil && s.Service.DesiredCount == nil {
+		s.Service.DesiredCount = pulumi.Int(w.MinTasks)
+	}
+	s.autoscaled = true
+
+	if err := s.Run(ctx, opts...); err != nil {
+		return err
+	}
+
+	ecsService := s.Out.Service
+	clusterName := ecsService.Cluster.ApplyT(func(cluster string) string {
+		return cluster[strings.LastIndex(cluster, "/")+1:]
+	}).(pulumi.StringOutput)
+	resourceID := pulumi.Sprintf("service/%s/%s", clusterName, ecsService.Name)
+
+	target, err := appautoscaling.NewTarget(ctx, fmt.Sprintf("%v-scaling-target", s.Name), &appautoscaling.TargetArgs{
+		MinCapacity:       pulumi.Int(w.MinTasks),
+		MaxCapacity:       pulumi.Int(w.MaxTasks),
+		ResourceId:        resourceID,
+		ScalableDimension: pulumi.String("ecs:service:DesiredCount"),
+		ServiceNamespace:  pulumi.String("ecs"),
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	w.Out.ScalingTarget = target
+
+	backlogPolicy, err := appautoscaling.NewPolicy(ctx, fmt.Sprintf("%v-backlog-scaling", s.Name), &appautoscaling.PolicyArgs{
+		PolicyType:        pulumi.String("TargetTrackingScaling"),
+		ResourceId:        target.ResourceId,
+		ScalableDimension: target.ScalableDimension,
+		ServiceNamespace:  target.ServiceNamespace,
+		TargetTrackingScalingPolicyConfiguration: &appautoscaling.PolicyTargetTrackingScalingPolicyConfigurationArgs{
+			TargetValue:      pulumi.Float64(float64(w.BacklogPerTask)),
+			ScaleInCooldown:  pulumi.Int(120),
+			ScaleOutCooldown: pulumi.Int(60),
+			CustomizedMetricSpecification: &appautoscaling.PolicyTargetTrackingScalingPolicyConfigurationCustomizedMetricSpecificationArgs{
+				Metrics: appautoscaling.PolicyTargetTrackingScalingPolicyConfigurationCustomizedMetricSpecificationMetricArray{
+					&appautoscaling.PolicyTargetTrackingScalingPolicyConfigurationCustomizedMetricSpecificationMetricArgs{
+						Id:         pulumi.String("visible"),
+						ReturnData: pulumi.Bool(false),
+						MetricStat: &appautoscaling.PolicyTargetTrackingScalingPolicyConfigurationCustomizedMetricSpecificationMetricMetricStatArgs{
+							Stat: pulumi.String("Sum"),
+							Metric: &appautoscaling.PolicyTargetTrackingScalingPolicyConfigurationCustomizedMetricSpecificationMetricMetricStatMetricArgs{
+								Namespace:  pulumi.String("AWS/SQS"),
+								MetricName: pulumi.String("ApproximateNumberOfMessagesVisible"),
+								Dimensions: appautoscaling.PolicyTargetTrackingScalingPolicyConfigurationCustomizedMetricSpecificationMetricMetricStatMetricDimensionArray{
+									&appautoscaling.PolicyTargetTrackingScalingPolicyConfigurationCustomizedMetricSpecificationMetricMetricStatMetricDimensionArgs{
+										Name:  pulumi.String("QueueName"),
+										Value: queue.Name,
+									},
+								},
+							},
+						},
+					},
+					&appautoscaling.PolicyTargetTrackingScalingPolicyConfigurationCustomizedMetricSpecificationMetricArgs{
+						Id:         pulumi.String("running"),
+						ReturnData: pulumi.Bool(false),
+						MetricStat: &appautoscaling.PolicyTargetTrackingScalingPolicyConfigurationCustomizedMetricSpecificationMetricMetricStatArgs{
+							Stat: pulumi.String("Average"),
+							Metric: &appautoscaling.PolicyTargetTrackingScalingPolicyConfigurationCustomizedMetricSpecificationMetricMetricStatMetricArgs{
+								Namespace:  pulumi.String("ECS/ContainerInsights"),
+								MetricName: pulumi.String("RunningTaskCount"),
+								Dimensions: appautoscaling.PolicyTargetTrackingScalingPolicyConfigurationCustomizedMetricSpecificationMetricMetricStatMetricDimensionArray{
+									&appautoscaling.PolicyTargetTrackingScalingPolicyConfigurationCustomizedMetricSpecificationMetricMetricStatMetricDimensionArgs{
+										Name:  pulumi.String("ClusterName"),
+										Value: clusterName,
+									},
+									&appautoscaling.PolicyTargetTrackingScalingPolicyConfigurationCustomizedMetricSpecificationMetricMetricStatMetricDimensionArgs{
+										Name:  pulumi.String("ServiceName"),
+										Value: ecsService.Name,
+									},
+								},
+							},
+						},
+					},
+					&appautoscaling.PolicyTargetTrackingScalingPolicyConfigurationCustomizedMetricSpecificationMetricArgs{
+						Id:         pulumi.String("backlog"),
+						Label:      pulumi.String("Backlog per task"),
+						Expression: pulumi.String("visible / running"),
+						ReturnData: pulumi.Bool(true),
+					},
+				},
+			},
+		},
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	w.Out.BacklogPolicy = backlogPolicy
+
+	if w.MinTasks > 0 {
+		return nil
+	}
+
+	// Target tracking can't scale out from zero running tasks, so start the
+	// first task when messages arrive while the service is scaled in.
+	scaleFromZero, err := appautoscaling.NewPolicy(ctx, fmt.Sprintf("%v-scale-from-zero", s.Name), &appautoscaling.PolicyArgs{
+		PolicyType:        pulumi.String("StepScaling"),
+		ResourceId:        target.ResourceId,
+		ScalableDimension: target.ScalableDimension,
+		ServiceNamespace:  target.ServiceNamespace,
+		StepScalingPolicyConfiguration: &appautoscaling.PolicyStepScalingPolicyConfigurationArgs{
+			AdjustmentType:        pulumi.String("ExactCapacity"),
+			Cooldown:              pulumi.Int(60),
+			MetricAggregationType: pulumi.String("Maximum"),
+			StepAdjustments: appautoscaling.PolicyStepScalingPolicyConfigurationStepAdjustmentArray{
+				&appautoscaling.PolicyStepScalingPolicyConfigurationStepAdjustmentArgs{
+					MetricIntervalLowerBound: pulumi.String("0"),
+					ScalingAdjustment:        pulumi.Int(1),
+				},
+			},
+		},
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	w.Out.ScaleFromZero = scaleFromZero
+
+	alarmName := fmt.Sprintf("%v-queue-waiting", s.Name)
+	alarm, err := cloudwatch.NewMetricAlarm(ctx, alarmName, &cloudwatch.MetricAlarmArgs{
+		Name:               pulumi.String(alarmName),
+		AlarmDescription:   pulumi.String(fmt.Sprintf("%v has queued messages and no running tasks", s.Name)),
+		ComparisonOperator: pulumi.String("GreaterThanOrEqualToThreshold"),
+		EvaluationPeriods:  pulumi.Int(1),
+		Threshold:          pulumi.Float64(1),
+		TreatMissingData:   pulumi.String("notBreaching"),
+		AlarmActions:       pulumi.Array{scaleFromZero.Arn},
+		MetricQueries: cloudwatch.MetricAlarmMetricQueryArray{
+			&cloudwatch.MetricAlarmMetricQueryArgs{
+				Id: pulumi.String("visible"),
+				Metric: &cloudwatch.MetricAlarmMetricQueryMetricArgs{
+					Namespace:  pulumi.String("AWS/SQS"),
+					MetricName: pulumi.String("ApproximateNumberOfMessagesVisible"),
+					Period:     pulumi.Int(60),
+					Stat:       pulumi.String("Maximum"),
+					Dimensions: pulumi.StringMap{
+						"QueueName": queue.Name,
+					},
+				},
+			},
+			&cloudwatch.MetricAlarmMetricQueryArgs{
+				Id: pulumi.String("running"),
+				Metric: &cloudwatch.MetricAlarmMetricQueryMetricArgs{
+					Namespace:  pulumi.String("ECS/ContainerInsights"),
+					MetricName: pulumi.String("RunningTaskCount"),
+					Period:     pulumi.Int(60),
+					Stat:       pulumi.String("Maximum"),
+					Dimensions: pulumi.StringMap{
+						"ClusterName": clusterName,
+						"ServiceName": ecsService.Name,
+					},
+				},
+			},
+			&cloudwatch.MetricAlarmMetricQueryArgs{
+				Id:         pulumi.String("waiting"),
+				Label:      pulumi.String("Messages waiting with no running tasks"),
+				Expression: pulumi.String("IF(visible > 0 AND FILL(running, 0) == 0, 1, 0)"),
+				ReturnData: pulumi.Bool(true),
+			},
+		},
+		Tags: pulumi.StringMap{
+			"Name": pulumi.String(alarmName),
+		},
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	w.Out.QueueAlarm = alarm
+
+	return nil
+}